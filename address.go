@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidAddress возвращается для пустого адреса или адреса
+// с управляющими символами, которые нельзя заменить пробелом
+var ErrInvalidAddress = errors.New("некорректный адрес")
+
+// normalizeAddress заменяет переводы строк, табуляции и прочие пробельные
+// управляющие символы одним пробелом и обрезает пробелы по краям.
+// Для пустого адреса или адреса с иными управляющими символами
+// возвращается ErrInvalidAddress
+func normalizeAddress(address string) (string, error) {
+	var b strings.Builder
+	space := false
+	for _, r := range address {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r):
+			return "", ErrInvalidAddress
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	if b.Len() == 0 {
+		return "", ErrInvalidAddress
+	}
+
+	return b.String(), nil
+}
+
+// AddressValidator проверяет адрес по правилам конкретного региона.
+// Адрес передаётся уже очищенным normalizeAddress
+type AddressValidator interface {
+	Validate(address string) error
+}
+
+// permissiveValidator валидатор по умолчанию, принимающий любой адрес
+type permissiveValidator struct{}
+
+func (permissiveValidator) Validate(string) error {
+	return nil
+}
+
+// prepareAddress очищает адрес и проверяет его валидатором сервиса
+func (s ParcelService) prepareAddress(address string) (string, error) {
+	address, err := normalizeAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.addressValidator.Validate(address); err != nil {
+		return "", err
+	}
+
+	return address, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeAddress проверяет очистку адреса от управляющих символов
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		expected string
+		err      error
+	}{
+		{name: "plain", address: "Псков, ул. Колотушкина, д. 5", expected: "Псков, ул. Колотушкина, д. 5"},
+		{name: "newline", address: "Псков,\nул. Колотушкина, д. 5\r\n", expected: "Псков, ул. Колотушкина, д. 5"},
+		{name: "tab", address: "Псков,\tул. Колотушкина,\t\tд. 5", expected: "Псков, ул. Колотушкина, д. 5"},
+		{name: "control", address: "Псков\x00, ул. Колотушкина", err: ErrInvalidAddress},
+		{name: "empty", address: " \t\n", err: ErrInvalidAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := normalizeAddress(tt.address)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.expected, address)
+		})
+	}
+}
+
+// errAddressTooShort возвращается minLengthValidator для коротких адресов
+var errAddressTooShort = errors.New("адрес слишком короткий")
+
+// minLengthValidator отклоняет адреса короче min символов
+type minLengthValidator struct {
+	min int
+}
+
+func (v minLengthValidator) Validate(address string) error {
+	if utf8.RuneCountInString(address) < v.min {
+		return errAddressTooShort
+	}
+	return nil
+}
+
+// TestAddressValidator проверяет, что сервис отклоняет адреса,
+// не прошедшие проверку валидатора
+func TestAddressValidator(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	strict := NewParcelService(store, WithAddressValidator(minLengthValidator{min: 10}))
+
+	// короткий адрес по умолчанию принимается
+	p, err := NewParcelService(store).Register(1000, "Псков")
+	require.NoError(t, err)
+
+	// check
+	_, err = strict.Register(1000, "Псков")
+	require.ErrorIs(t, err, errAddressTooShort)
+
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+
+	err = strict.ChangeAddress(p.Number, "Москва")
+	require.ErrorIs(t, err, errAddressTooShort)
+
+	stored, err := store.Get(p.Number)
+	require.NoError(t, err)
+	require.Equal(t, "Псков", stored.Address)
+
+	require.NoError(t, strict.ChangeAddress(p.Number, "Псков, ул. Колотушкина, д. 5"))
+}
@@ -0,0 +1,36 @@
+package main
+
+import "time"
+
+// Age возвращает, сколько посылка существует к моменту now.
+// Если время создания не удаётся разобрать, возвращается 0
+func (p Parcel) Age(now time.Time) time.Duration {
+	createdAt, err := time.Parse(time.RFC3339, p.CreatedAt)
+	if err != nil {
+		return 0
+	}
+
+	return now.Sub(createdAt)
+}
+
+// ParcelWithAge посылка вместе с её возрастом на момент запроса
+type ParcelWithAge struct {
+	Parcel
+	Age time.Duration `json:"age"`
+}
+
+// GetByClientWithAge возвращает посылки клиента вместе с возрастом
+// каждой на момент now
+func (s ParcelStore) GetByClientWithAge(client int, now time.Time) ([]ParcelWithAge, error) {
+	parcels, err := s.GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]ParcelWithAge, 0, len(parcels))
+	for _, p := range parcels {
+		res = append(res, ParcelWithAge{Parcel: p, Age: p.Age(now)})
+	}
+
+	return res, nil
+}
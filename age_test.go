@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestParcelAge проверяет вычисление возраста посылки
+func TestParcelAge(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		createdAt string
+		expected  time.Duration
+	}{
+		{name: "day and a half", createdAt: "2024-03-01T00:00:00Z", expected: 36 * time.Hour},
+		{name: "other zone", createdAt: "2024-03-02T14:00:00+03:00", expected: time.Hour},
+		{name: "just created", createdAt: "2024-03-02T12:00:00Z", expected: 0},
+		{name: "malformed", createdAt: "вчера", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, Parcel{CreatedAt: tt.createdAt}.Age(now))
+		})
+	}
+}
+
+// TestGetByClientWithAge проверяет получение посылок клиента с возрастом
+func TestGetByClientWithAge(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	now := time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)
+	ages := map[int]time.Duration{}
+	for _, age := range []time.Duration{time.Hour, 30 * time.Hour} {
+		p := getTestParcel()
+		p.CreatedAt = now.Add(-age).Format(time.RFC3339)
+		id, err := store.Add(p)
+		require.NoError(t, err)
+		ages[id] = age
+	}
+
+	// check
+	parcels, err := store.GetByClientWithAge(getTestParcel().Client, now)
+	require.NoError(t, err)
+	require.Len(t, parcels, len(ages))
+	for _, p := range parcels {
+		require.Equal(t, ages[p.Number], p.Age)
+	}
+
+	parcels, err = store.GetByClientWithAge(getTestParcel().Client+1, now)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// источники посылки, которые возвращает GetAnywhere
+const (
+	ParcelSourceActive  = "parcel"
+	ParcelSourceArchive = "parcel_archive"
+)
+
+// archiveColumns столбцы, общие для parcel и parcel_archive. Новый столбец
+// parcelColumns нужно добавить и в таблицу parcel_archive
+const archiveColumns = parcelColumns + ", status_changed_at, delivered_at, metadata"
+
+// ArchiveDelivered переносит в parcel_archive посылки, доставленные
+// раньше before, и возвращает количество перенесённых посылок
+func (s ParcelStore) ArchiveDelivered(before time.Time) (int, error) {
+	archivedAt := time.Now().UTC().Format(time.RFC3339)
+	where := "status = :delivered AND delivered_at != '' AND delivered_at < :before"
+	args := []interface{}{
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("before", before.UTC().Format(time.RFC3339)),
+	}
+
+	var archived int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		_, err := tx.q.Exec("INSERT INTO parcel_archive ("+archiveColumns+", archived_at) SELECT "+archiveColumns+", :archived_at FROM parcel WHERE "+where,
+			append(args, sql.Named("archived_at", archivedAt))...)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChangesWhere(ChangeArchive, where, args...); err != nil {
+			return err
+		}
+
+		res, err := tx.q.Exec("DELETE FROM parcel WHERE "+where, args...)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		archived = int(n)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return archived, nil
+}
+
+// GetAnywhere ищет посылку сначала среди активных, затем в архиве
+// и возвращает её вместе с источником: ParcelSourceActive
+// или ParcelSourceArchive
+func (s ParcelStore) GetAnywhere(number int) (Parcel, string, error) {
+	var p Parcel
+	var source string
+	err := s.inTx(&sql.TxOptions{ReadOnly: true}, func(tx ParcelStore) error {
+		var err error
+		p, err = tx.Get(number)
+		if err == nil {
+			source = ParcelSourceActive
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		row := tx.q.QueryRow("SELECT "+parcelColumns+" FROM parcel_archive WHERE number = :number",
+			sql.Named("number", number))
+		p, err = scanParcel(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrParcelNotFound
+		}
+		if err != nil {
+			return err
+		}
+		source = ParcelSourceArchive
+
+		return nil
+	})
+	if err != nil {
+		return Parcel{}, "", err
+	}
+
+	return p, source, nil
+}
+
+// Unarchive возвращает посылку number из parcel_archive в parcel со статусом
+// delivered, например чтобы оформить по ней возврат. Если в архиве такой
+// посылки нет, возвращается ErrParcelNotFound
+func (s ParcelStore) Unarchive(number int) error {
+	return s.inTx(nil, func(tx ParcelStore) error {
+		res, err := tx.q.Exec("INSERT INTO parcel ("+archiveColumns+") SELECT "+archiveColumns+" FROM parcel_archive WHERE number = :number",
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrParcelNotFound
+		}
+
+		_, err = tx.q.Exec("UPDATE parcel SET status = :delivered WHERE number = :number",
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChange(number, ChangeUnarchive); err != nil {
+			return err
+		}
+
+		_, err = tx.q.Exec("DELETE FROM parcel_archive WHERE number = :number", sql.Named("number", number))
+
+		return err
+	})
+}
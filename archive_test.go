@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetAnywhere проверяет поиск посылки среди активных и в архиве
+func TestGetAnywhere(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	activeID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	archivedID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(archivedID, ParcelStatusDelivered))
+	_, err = db.Exec("UPDATE parcel SET delivered_at = :delivered_at WHERE number = :number",
+		sql.Named("delivered_at", time.Now().Add(-60*24*time.Hour).UTC().Format(time.RFC3339)),
+		sql.Named("number", archivedID))
+	require.NoError(t, err)
+
+	// archive
+	n, err := store.ArchiveDelivered(time.Now().Add(-30 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	_, err = store.Get(archivedID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// check
+	parcel, source, err := store.GetAnywhere(activeID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelSourceActive, source)
+	require.Equal(t, activeID, parcel.Number)
+
+	parcel, source, err = store.GetAnywhere(archivedID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelSourceArchive, source)
+	require.Equal(t, archivedID, parcel.Number)
+	require.Equal(t, ParcelStatusDelivered, parcel.Status)
+
+	_, _, err = store.GetAnywhere(archivedID + 100)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestUnarchive проверяет возврат посылки из архива в активные
+func TestUnarchive(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+
+	n, err := store.ArchiveDelivered(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// unarchive
+	require.NoError(t, store.Unarchive(id))
+
+	// check
+	parcel, source, err := store.GetAnywhere(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelSourceActive, source)
+	require.Equal(t, ParcelStatusDelivered, parcel.Status)
+
+	var archived int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM parcel_archive").Scan(&archived))
+	require.Zero(t, archived)
+
+	err = store.Unarchive(id)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	err = store.Unarchive(id + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// виды проблем, которые находит Audit
+const (
+	AuditUnknownStatus              = "unknown_status"
+	AuditDeliveredWithoutTime       = "delivered_without_delivered_at"
+	AuditDeliveredBeforeCreated     = "delivered_before_created"
+	AuditStatusChangedBeforeCreated = "status_changed_before_created"
+	AuditProcessingWithoutClaim     = "processing_without_claim"
+)
+
+// AuditIssue проблема, найденная Audit у одной посылки
+type AuditIssue struct {
+	Number int    `json:"number"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// auditRules условия, по которым Audit ищет посылки в невозможных состояниях
+var auditRules = []struct {
+	kind   string
+	clause string
+	detail string
+}{
+	{AuditUnknownStatus, "status NOT IN (:registered, :sent, :delivered, :failed, :processing)",
+		"неизвестный статус"},
+	{AuditDeliveredWithoutTime, "status = :delivered AND delivered_at = ''",
+		"посылка доставлена, но время доставки не записано"},
+	{AuditDeliveredBeforeCreated, "delivered_at != '' AND delivered_at < created_at",
+		"время доставки раньше времени создания"},
+	{AuditStatusChangedBeforeCreated, "status_changed_at != '' AND status_changed_at < created_at",
+		"статус сменился раньше, чем посылка была создана"},
+	{AuditProcessingWithoutClaim, "status = :processing AND claimed_by = ''",
+		"посылка в работе, но обработчик не указан"},
+}
+
+// Audit проверяет все посылки на невозможные состояния и возвращает
+// найденные проблемы, упорядоченные по номеру посылки. У одной посылки
+// может быть несколько проблем
+func (s ParcelStore) Audit() ([]AuditIssue, error) {
+	args := []interface{}{
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("failed", ParcelStatusFailed),
+		sql.Named("processing", ParcelStatusProcessing),
+	}
+
+	var issues []AuditIssue
+	err := s.inTx(&sql.TxOptions{ReadOnly: true}, func(tx ParcelStore) error {
+		for _, rule := range auditRules {
+			numbers, err := tx.numbersWhere(rule.clause, args...)
+			if err != nil {
+				return err
+			}
+			for _, number := range numbers {
+				issues = append(issues, AuditIssue{Number: number, Kind: rule.kind, Detail: rule.detail})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Number < issues[j].Number
+	})
+
+	return issues, nil
+}
+
+// numbersWhere возвращает номера посылок, подходящих под условие clause,
+// в порядке возрастания. Как и в countWhere, значения передаются только через args
+func (s ParcelStore) numbersWhere(clause string, args ...interface{}) ([]int, error) {
+	rows, err := s.q.Query("SELECT number FROM parcel WHERE "+clause+" ORDER BY number ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var numbers []int
+	for rows.Next() {
+		var number int
+		if err := rows.Scan(&number); err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return numbers, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAudit проверяет, что Audit находит каждый вид невозможного состояния
+func TestAudit(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	add := func(update string) int {
+		parcel := getTestParcel()
+		parcel.CreatedAt = "2024-03-01T12:00:00Z"
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+
+		if update != "" {
+			_, err = db.Exec("UPDATE parcel SET "+update+" WHERE number = :number", sql.Named("number", id))
+			require.NoError(t, err)
+		}
+
+		return id
+	}
+
+	okID := add("")
+	unknownID := add("status = 'lost'")
+	noDeliveredAtID := add("status = 'delivered', delivered_at = ''")
+	deliveredEarlyID := add("status = 'delivered', delivered_at = '2024-02-01T12:00:00Z', status_changed_at = '2024-02-01T12:00:00Z'")
+	changedEarlyID := add("status = 'sent', status_changed_at = '2024-02-20T12:00:00Z'")
+	unclaimedID := add("status = 'processing', claimed_by = ''")
+
+	// audit
+	issues, err := store.Audit()
+	require.NoError(t, err)
+
+	// check
+	kinds := map[int][]string{}
+	for _, issue := range issues {
+		require.NotEmpty(t, issue.Detail)
+		kinds[issue.Number] = append(kinds[issue.Number], issue.Kind)
+	}
+
+	require.NotContains(t, kinds, okID)
+	require.Equal(t, []string{AuditUnknownStatus}, kinds[unknownID])
+	require.Equal(t, []string{AuditDeliveredWithoutTime}, kinds[noDeliveredAtID])
+	require.Equal(t, []string{AuditDeliveredBeforeCreated, AuditStatusChangedBeforeCreated}, kinds[deliveredEarlyID])
+	require.Equal(t, []string{AuditStatusChangedBeforeCreated}, kinds[changedEarlyID])
+	require.Equal(t, []string{AuditProcessingWithoutClaim}, kinds[unclaimedID])
+
+	for i := 1; i < len(issues); i++ {
+		require.LessOrEqual(t, issues[i-1].Number, issues[i].Number)
+	}
+}
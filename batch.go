@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Batch накапливает изменения посылок, чтобы выполнить их одной транзакцией.
+// Создаётся через ParcelStore.NewBatch, операции добавляются цепочкой:
+//
+//	results, err := store.NewBatch().
+//		Register(p).
+//		SetStatus(number, ParcelStatusSent).
+//		Delete(other).
+//		Commit()
+type Batch struct {
+	store ParcelStore
+	ops   []batchOp
+}
+
+// BatchResult результат одной операции пакета: название операции
+// и номер посылки, для Register - номер новой посылки
+type BatchResult struct {
+	Op     string
+	Number int
+}
+
+type batchOp struct {
+	name string
+	run  func(tx ParcelStore) (int, error)
+}
+
+// NewBatch возвращает пустой пакет операций над хранилищем
+func (s ParcelStore) NewBatch() *Batch {
+	return &Batch{store: s}
+}
+
+// Register добавляет в пакет регистрацию посылки p
+func (b *Batch) Register(p Parcel) *Batch {
+	b.ops = append(b.ops, batchOp{name: "register", run: func(tx ParcelStore) (int, error) {
+		return tx.Add(p)
+	}})
+
+	return b
+}
+
+// SetStatus добавляет в пакет смену статуса посылки. В отличие
+// от ParcelStore.SetStatus отсутствие посылки считается ошибкой
+func (b *Batch) SetStatus(number int, status string) *Batch {
+	b.ops = append(b.ops, batchOp{name: "set_status", run: func(tx ParcelStore) (int, error) {
+		if _, err := tx.GetStatus(number); err != nil {
+			return 0, err
+		}
+
+		return number, tx.SetStatus(number, status)
+	}})
+
+	return b
+}
+
+// Delete добавляет в пакет удаление посылки. В отличие от ParcelStore.Delete
+// отсутствие посылки или статус, отличный от registered, считаются ошибкой
+func (b *Batch) Delete(number int) *Batch {
+	b.ops = append(b.ops, batchOp{name: "delete", run: func(tx ParcelStore) (int, error) {
+		status, err := tx.GetStatus(number)
+		if err != nil {
+			return 0, err
+		}
+		if status != ParcelStatusRegistered {
+			return 0, ErrNotRegistered
+		}
+
+		return number, tx.Delete(number)
+	}})
+
+	return b
+}
+
+// Commit выполняет накопленные операции в одной транзакции и возвращает
+// их результаты в порядке добавления. Если какая-то операция завершилась
+// ошибкой, изменения всех операций пакета откатываются
+func (b *Batch) Commit() ([]BatchResult, error) {
+	results := make([]BatchResult, 0, len(b.ops))
+	err := b.store.inTx(nil, func(tx ParcelStore) error {
+		for i, op := range b.ops {
+			number, err := op.run(tx)
+			if err != nil {
+				return fmt.Errorf("операция %d (%s): %w", i, op.name, err)
+			}
+			results = append(results, BatchResult{Op: op.name, Number: number})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
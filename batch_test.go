@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestBatchCommit проверяет выполнение пакета операций
+func TestBatchCommit(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	sentID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	deleteID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// commit
+	results, err := store.NewBatch().
+		Register(getTestParcel()).
+		SetStatus(sentID, ParcelStatusSent).
+		Delete(deleteID).
+		Commit()
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, results, 3)
+	require.Equal(t, "register", results[0].Op)
+	require.Equal(t, BatchResult{Op: "set_status", Number: sentID}, results[1])
+	require.Equal(t, BatchResult{Op: "delete", Number: deleteID}, results[2])
+
+	registered, err := store.Get(results[0].Number)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, registered.Status)
+
+	status, err := store.GetStatus(sentID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	_, err = store.GetStatus(deleteID)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestBatchRollback проверяет, что ошибка в середине пакета
+// откатывает все его операции
+func TestBatchRollback(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	registeredID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	sentID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sentID, ParcelStatusSent))
+
+	total, err := store.Total()
+	require.NoError(t, err)
+
+	// удалить отправленную посылку нельзя, пакет должен откатиться
+	results, err := store.NewBatch().
+		Register(getTestParcel()).
+		SetStatus(registeredID, ParcelStatusSent).
+		Delete(sentID).
+		SetStatus(registeredID, ParcelStatusDelivered).
+		Commit()
+	require.ErrorIs(t, err, ErrNotRegistered)
+	require.Nil(t, results)
+
+	// check
+	after, err := store.Total()
+	require.NoError(t, err)
+	require.Equal(t, total, after)
+
+	status, err := store.GetStatus(registeredID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, status)
+
+	// отсутствующая посылка тоже считается ошибкой
+	_, err = store.NewBatch().SetStatus(sentID+100, ParcelStatusSent).Commit()
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// statusCountCache хранит результат CountByStatusCached до истечения срока
+// или до первого изменения данных через хранилище. Методы безопасно
+// вызывать у nil: тогда кеширование отключено
+type statusCountCache struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	expires time.Time
+	// generation увеличивается при каждом сбросе, чтобы не сохранить
+	// значения, прочитанные до изменения, которое завершилось раньше чтения
+	generation uint64
+}
+
+// get возвращает копию закешированных значений, если срок их жизни не истёк,
+// и текущее поколение кеша для последующего set
+func (c *statusCountCache) get(now time.Time) (map[string]int, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil || !now.Before(c.expires) {
+		return nil, c.generation, false
+	}
+
+	return copyCounts(c.counts), c.generation, true
+}
+
+// set запоминает counts, если с момента get кеш не сбрасывался
+func (c *statusCountCache) set(counts map[string]int, expires time.Time, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.counts = copyCounts(counts)
+	c.expires = expires
+}
+
+func (c *statusCountCache) invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts = nil
+	c.generation++
+}
+
+// wrap возвращает querier, сбрасывающий кеш после каждого Exec.
+// Все изменения хранилища выполняются через Exec, так что любое
+// из них делает закешированные значения недействительными
+func (c *statusCountCache) wrap(q querier) querier {
+	if c == nil {
+		return q
+	}
+
+	return invalidatingQuerier{querier: q, cache: c}
+}
+
+type invalidatingQuerier struct {
+	querier
+	cache *statusCountCache
+}
+
+func (q invalidatingQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer q.cache.invalidate()
+
+	return q.querier.Exec(query, args...)
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	res := make(map[string]int, len(counts))
+	for status, n := range counts {
+		res[status] = n
+	}
+
+	return res
+}
+
+// CountByStatusCached возвращает количество посылок в каждом статусе.
+// Результат запоминается на ttl и сбрасывается при любом изменении
+// через это хранилище или его копии (в том числе в транзакциях).
+// Изменения, сделанные в БД в обход хранилища, кеш не замечает.
+// Внутри транзакции кеш не используется, так как она видит
+// ещё не зафиксированные изменения
+func (s ParcelStore) CountByStatusCached(ttl time.Duration) (map[string]int, error) {
+	cache := s.counts
+	if s.tx != nil {
+		cache = nil
+	}
+
+	now := time.Now()
+	counts, generation, ok := cache.get(now)
+	if ok {
+		return counts, nil
+	}
+
+	rows, err := s.q.Query("SELECT status, COUNT(*) FROM parcel GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts = map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cache.set(counts, now.Add(ttl), generation)
+
+	return counts, nil
+}
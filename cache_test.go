@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingQuerier считает запросы на чтение, дошедшие до БД
+type countingQuerier struct {
+	querier
+	queries int
+}
+
+func (q *countingQuerier) Query(query string, args ...interface{}) (sqlRows, error) {
+	q.queries++
+	return q.querier.Query(query, args...)
+}
+
+// TestCountByStatusCached проверяет, что повторный вызов в пределах ttl
+// не обращается к БД, а изменение данных сбрасывает кеш
+func TestCountByStatusCached(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	counter := &countingQuerier{querier: timeoutQuerier{q: db, parent: context.Background()}}
+	store.q = store.counts.wrap(counter)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// first call
+	counts, err := store.CountByStatusCached(time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 2}, counts)
+	require.Equal(t, 1, counter.queries)
+
+	// cached
+	counts, err = store.CountByStatusCached(time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 2}, counts)
+	require.Equal(t, 1, counter.queries)
+
+	// изменение результата вызывающим не портит кеш
+	counts[ParcelStatusRegistered] = 100
+	counts, err = store.CountByStatusCached(time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 2, counts[ParcelStatusRegistered])
+
+	// mutation
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	counts, err = store.CountByStatusCached(time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{ParcelStatusRegistered: 1, ParcelStatusSent: 1}, counts)
+	require.Equal(t, 2, counter.queries)
+
+	// с нулевым ttl значения сразу устаревают
+	require.NoError(t, store.SetPriority(id, true))
+	_, err = store.CountByStatusCached(0)
+	require.NoError(t, err)
+	_, err = store.CountByStatusCached(0)
+	require.NoError(t, err)
+	require.Equal(t, 4, counter.queries)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// виды операций в журнале изменений
+const (
+	ChangeAdd        = "add"
+	ChangeSetStatus  = "set_status"
+	ChangeSetAddress = "set_address"
+	ChangeDelete     = "delete"
+	ChangeArchive    = "archive"
+	ChangeUnarchive  = "unarchive"
+	ChangePut        = "put"
+)
+
+// ChangeEntry запись журнала изменений: какая операция и когда
+// была выполнена над посылкой Number
+type ChangeEntry struct {
+	Number    int
+	Op        string
+	ChangedAt string
+}
+
+// addChange записывает в changelog операцию op над посылкой number
+func (s ParcelStore) addChange(number int, op string) error {
+	_, err := s.q.Exec("INSERT INTO changelog (number, op, changed_at) VALUES (:number, :op, :changed_at)",
+		sql.Named("number", number),
+		sql.Named("op", op),
+		sql.Named("changed_at", time.Now().UTC().Format(time.RFC3339)))
+
+	return err
+}
+
+// addChangeIfUpdated вызывает addChange, только если запрос res изменил строку
+func (s ParcelStore) addChangeIfUpdated(res sql.Result, number int, op string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	return s.addChange(number, op)
+}
+
+// addChangesWhere записывает в changelog операцию op над каждой посылкой,
+// подходящей под условие clause. Вызывается до изменения, пока посылки
+// ещё подходят под условие. Как и в countWhere, clause подставляется
+// в запрос как есть, а значения передаются только через args
+func (s ParcelStore) addChangesWhere(op, clause string, args ...interface{}) error {
+	_, err := s.q.Exec("INSERT INTO changelog (number, op, changed_at) SELECT number, :change_op, :change_at FROM parcel WHERE "+clause,
+		append(args,
+			sql.Named("change_op", op),
+			sql.Named("change_at", time.Now().UTC().Format(time.RFC3339)))...)
+
+	return err
+}
+
+// RecentChanges возвращает последние limit записей журнала изменений
+// в порядке выполнения операций, 0 означает без ограничения
+func (s ParcelStore) RecentChanges(limit int) ([]ChangeEntry, error) {
+	// в SQLite отрицательный LIMIT снимает ограничение
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.q.Query(`SELECT number, op, changed_at FROM (
+    SELECT id, number, op, changed_at FROM changelog ORDER BY id DESC LIMIT :limit
+) ORDER BY id ASC`,
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []ChangeEntry
+	for rows.Next() {
+		var e ChangeEntry
+		if err := rows.Scan(&e.Number, &e.Op, &e.ChangedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecentChanges проверяет, что журнал изменений отражает
+// выполненные операции в порядке их выполнения
+func TestRecentChanges(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetAddress(first, "Псков, ул. Колотушкина, д. 5"))
+	require.NoError(t, store.SetStatus(first, ParcelStatusSent))
+	require.NoError(t, store.Delete(second))
+
+	// операции над отсутствующей посылкой в журнал не попадают
+	require.NoError(t, store.SetStatus(second, ParcelStatusSent))
+	require.NoError(t, store.SetAddress(first, "Москва"))
+
+	// check
+	changes, err := store.RecentChanges(0)
+	require.NoError(t, err)
+
+	type op struct {
+		number int
+		op     string
+	}
+	var ops []op
+	for _, c := range changes {
+		require.NotEmpty(t, c.ChangedAt)
+		ops = append(ops, op{c.Number, c.Op})
+	}
+	require.Equal(t, []op{
+		{first, ChangeAdd},
+		{second, ChangeAdd},
+		{first, ChangeSetAddress},
+		{first, ChangeSetStatus},
+		{second, ChangeDelete},
+	}, ops)
+
+	changes, err = store.RecentChanges(2)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, ChangeSetStatus, changes[0].Op)
+	require.Equal(t, ChangeDelete, changes[1].Op)
+}
+
+// TestRecentChangesStatusOperations проверяет, что в журнал попадают
+// все операции, меняющие статус посылки
+func TestRecentChangesStatusOperations(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// operations
+	claimed, ok, err := store.ClaimNext("worker-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, id, claimed.Number)
+	require.NoError(t, store.ReleaseClaim(id, "worker-1"))
+
+	n, err := store.DispatchAllRegistered()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, store.MarkFailed(id))
+
+	parcel, err := store.Get(id)
+	require.NoError(t, err)
+	_, err = store.SetStatusCAS(id, parcel.Version, ParcelStatusDelivered)
+	require.NoError(t, err)
+
+	n, err = store.ArchiveDelivered(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, store.Unarchive(id))
+
+	n, err = store.RenameStatus(ParcelStatusDelivered, "handed_over")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// check
+	changes, err := store.RecentChanges(0)
+	require.NoError(t, err)
+
+	var ops []string
+	for _, c := range changes {
+		require.Equal(t, id, c.Number)
+		ops = append(ops, c.Op)
+	}
+	require.Equal(t, []string{
+		ChangeAdd,
+		ChangeSetStatus, // ClaimNext
+		ChangeSetStatus, // ReleaseClaim
+		ChangeSetStatus, // DispatchAllRegistered
+		ChangeSetStatus, // MarkFailed
+		ChangeSetStatus, // SetStatusCAS
+		ChangeArchive,
+		ChangeUnarchive,
+		ChangeSetStatus, // RenameStatus
+	}, ops)
+}
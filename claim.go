@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotClaimed возвращается, когда посылка не находится в работе
+	ErrNotClaimed = errors.New("посылка не взята в работу")
+	// ErrClaimedByOther возвращается, когда посылку взял в работу другой обработчик
+	ErrClaimedByOther = errors.New("посылка взята в работу другим обработчиком")
+)
+
+// ClaimNext берёт в работу самую старую зарегистрированную посылку:
+// переводит её в статус processing с пометкой workerID и возвращает.
+// Выбор и пометка выполняются одним запросом, поэтому два обработчика
+// не могут получить одну и ту же посылку. Если свободных посылок нет,
+// возвращается false
+func (s ParcelStore) ClaimNext(workerID string) (Parcel, bool, error) {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+
+	var p Parcel
+	var claimed bool
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		row := tx.q.QueryRow(`UPDATE parcel SET status = :processing, claimed_by = :worker, claimed_at = :changed_at, status_changed_at = :changed_at, version = version + 1
+WHERE number = (
+    SELECT number FROM parcel WHERE status = :registered ORDER BY created_at ASC, number ASC LIMIT 1
+) AND status = :registered
+RETURNING `+parcelColumns,
+			sql.Named("processing", ParcelStatusProcessing),
+			sql.Named("worker", workerID),
+			sql.Named("changed_at", changedAt),
+			sql.Named("registered", ParcelStatusRegistered))
+
+		var err error
+		p, err = scanParcel(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = true
+
+		if err := tx.addChange(p.Number, ChangeSetStatus); err != nil {
+			return err
+		}
+
+		return tx.addHistory(p.Number, ParcelStatusProcessing, changedAt)
+	})
+	if err != nil || !claimed {
+		return Parcel{}, false, err
+	}
+
+	return p, true, nil
+}
+
+// ReleaseClaim возвращает посылку, взятую в работу обработчиком workerID,
+// обратно в статус registered, чтобы её мог взять другой обработчик
+func (s ParcelStore) ReleaseClaim(number int, workerID string) error {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+
+	return s.inTx(nil, func(tx ParcelStore) error {
+		p, err := tx.Get(number)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrParcelNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if p.Status != ParcelStatusProcessing {
+			return ErrNotClaimed
+		}
+		if p.ClaimedBy != workerID {
+			return ErrClaimedByOther
+		}
+
+		_, err = tx.q.Exec("UPDATE parcel SET status = :registered, claimed_by = '', claimed_at = '', status_changed_at = :changed_at, version = version + 1 WHERE number = :number",
+			sql.Named("registered", ParcelStatusRegistered),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChange(number, ChangeSetStatus); err != nil {
+			return err
+		}
+
+		return tx.addHistory(number, ParcelStatusRegistered, changedAt)
+	})
+}
+
+// FindStaleClaims возвращает посылки в работе, взятые раньше olderThan,
+// например обработчиком, который завершился аварийно
+func (s ParcelStore) FindStaleClaims(olderThan time.Time) ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE status = :processing AND claimed_at < :before ORDER BY claimed_at ASC, number ASC",
+		sql.Named("processing", ParcelStatusProcessing),
+		sql.Named("before", olderThan.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
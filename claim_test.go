@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestClaimNext проверяет, что параллельные обработчики не берут одну посылку дважды
+func TestClaimNext(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	const parcels = 20
+	for i := 0; i < parcels; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// каждый обработчик работает через своё соединение с той же БД
+	var path string
+	require.NoError(t, db.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&path))
+
+	const workers = 5
+	stores := make([]ParcelStore, workers)
+	for w := range stores {
+		workerDB, err := sql.Open("sqlite", withBusyTimeout(path))
+		require.NoError(t, err)
+		t.Cleanup(func() { workerDB.Close() })
+		workerDB.SetMaxOpenConns(1)
+		stores[w] = NewParcelStore(workerDB)
+	}
+
+	// claim
+	var mu sync.Mutex
+	claimedBy := map[int]string{}
+	claims := 0
+	errs := make(chan error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(store ParcelStore, workerID string) {
+			defer wg.Done()
+			for {
+				p, ok, err := store.ClaimNext(workerID)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !ok {
+					return
+				}
+
+				mu.Lock()
+				claims++
+				if other, dup := claimedBy[p.Number]; dup {
+					errs <- fmt.Errorf("parcel %d claimed by %s and %s", p.Number, other, workerID)
+				}
+				claimedBy[p.Number] = workerID
+				mu.Unlock()
+			}
+		}(stores[w], fmt.Sprintf("worker-%d", w))
+	}
+	wg.Wait()
+	close(errs)
+
+	// check
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	// каждая посылка взята ровно один раз
+	require.Equal(t, parcels, claims)
+	require.Len(t, claimedBy, parcels)
+
+	for number, workerID := range claimedBy {
+		stored, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusProcessing, stored.Status)
+		require.Equal(t, workerID, stored.ClaimedBy)
+	}
+
+	_, ok, err := store.ClaimNext("worker-late")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// TestReleaseClaim проверяет возврат взятой в работу посылки
+func TestReleaseClaim(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	p, ok, err := store.ClaimNext("worker-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, id, p.Number)
+
+	// wrong worker
+	err = store.ReleaseClaim(id, "worker-2")
+	require.ErrorIs(t, err, ErrClaimedByOther)
+
+	// release
+	require.NoError(t, store.ReleaseClaim(id, "worker-1"))
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Empty(t, stored.ClaimedBy)
+
+	// повторное освобождение
+	err = store.ReleaseClaim(id, "worker-1")
+	require.ErrorIs(t, err, ErrNotClaimed)
+
+	// посылку снова можно взять в работу
+	p, ok, err = store.ClaimNext("worker-2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, id, p.Number)
+}
+
+// TestSetStatusClearsClaim проверяет, что посылка, выведенная из статуса
+// processing, перестаёт быть взятой в работу
+func TestSetStatusClearsClaim(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	sent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	failed, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	for _, id := range []int{sent, failed} {
+		p, ok, err := store.ClaimNext("worker-1")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, id, p.Number)
+		require.Equal(t, "worker-1", p.ClaimedBy)
+	}
+
+	// processing -> processing не снимает пометку
+	require.NoError(t, store.SetStatus(sent, ParcelStatusProcessing))
+	stored, err := store.Get(sent)
+	require.NoError(t, err)
+	require.Equal(t, "worker-1", stored.ClaimedBy)
+
+	// change
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+	require.NoError(t, store.MarkFailed(failed))
+
+	// check
+	for _, id := range []int{sent, failed} {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		require.Empty(t, stored.ClaimedBy)
+		require.Empty(t, stored.ClaimedAt)
+	}
+}
+
+// TestFindStaleClaims проверяет поиск давно взятых в работу посылок
+func TestFindStaleClaims(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	for i := 0; i < 2; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	stale, ok, err := store.ClaimNext("worker-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotEmpty(t, stale.ClaimedAt)
+
+	_, ok, err = store.ClaimNext("worker-2")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// первую посылку взяли в работу час назад
+	hourAgo := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	_, err = db.Exec("UPDATE parcel SET claimed_at = :claimed_at WHERE number = :number",
+		sql.Named("claimed_at", hourAgo),
+		sql.Named("number", stale.Number))
+	require.NoError(t, err)
+
+	// check
+	found, err := store.FindStaleClaims(time.Now().Add(-10 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, stale.Number, found[0].Number)
+	require.Equal(t, "worker-1", found[0].ClaimedBy)
+}
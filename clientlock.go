@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// clientLocks мьютексы по идентификатору клиента: изменения посылок
+// одного клиента через сервис выполняются по очереди, а разных клиентов -
+// параллельно. Мьютексы создаются при первом обращении и не удаляются
+type clientLocks struct {
+	mu    sync.Mutex
+	locks map[int]*sync.Mutex
+}
+
+func newClientLocks() *clientLocks {
+	return &clientLocks{locks: map[int]*sync.Mutex{}}
+}
+
+// lock захватывает мьютексы клиентов clients и возвращает функцию,
+// освобождающую их. Мьютексы захватываются в порядке возрастания
+// идентификаторов: иначе две операции над несколькими клиентами,
+// захватывающие их в разном порядке, могли бы заблокировать друг друга
+// навсегда
+func (l *clientLocks) lock(clients ...int) (unlock func()) {
+	clients = append([]int(nil), clients...)
+	sort.Ints(clients)
+
+	var held []*sync.Mutex
+	for i, client := range clients {
+		if i > 0 && client == clients[i-1] {
+			continue
+		}
+
+		l.mu.Lock()
+		m, ok := l.locks[client]
+		if !ok {
+			m = &sync.Mutex{}
+			l.locks[client] = m
+		}
+		l.mu.Unlock()
+
+		m.Lock()
+		held = append(held, m)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Unlock()
+		}
+	}
+}
+
+// lockParcelClient захватывает мьютекс клиента посылки number и мьютексы
+// клиентов extra. Если посылки нет, блокировать нечего: возвращается
+// пустая функция, а об ошибке сообщит сама операция
+func (s ParcelService) lockParcelClient(number int, extra ...int) (unlock func(), err error) {
+	return s.lockParcelClients([]int{number}, extra...)
+}
+
+// lockParcelClients захватывает мьютексы клиентов посылок numbers
+// и клиентов extra. Клиент читается до захвата мьютекса, поэтому после
+// захвата он проверяется снова: если посылку за это время передали
+// другому клиенту (см. Correct), мьютексы освобождаются и захватываются
+// заново. Отсутствующие посылки пропускаются
+func (s ParcelService) lockParcelClients(numbers []int, extra ...int) (unlock func(), err error) {
+	clients, err := s.parcelClients(numbers)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		unlock := s.clientLocks.lock(append(append([]int(nil), extra...), clients...)...)
+
+		current, err := s.parcelClients(numbers)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		if slices.Equal(current, clients) {
+			return unlock, nil
+		}
+
+		unlock()
+		clients = current
+	}
+}
+
+// parcelClients возвращает клиентов существующих посылок из numbers
+// в порядке номеров
+func (s ParcelService) parcelClients(numbers []int) ([]int, error) {
+	var clients []int
+	for _, number := range numbers {
+		parcel, err := s.store.Get(number)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, parcel.Client)
+	}
+
+	return clients, nil
+}
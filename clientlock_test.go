@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowStatusModel модель переходов, которая долго вычисляет следующий
+// статус, чтобы между чтением посылки и записью статуса был заметный
+// промежуток
+type slowStatusModel struct {
+	linearStatusModel
+}
+
+func (m slowStatusModel) Next(status string) (string, bool) {
+	time.Sleep(10 * time.Millisecond)
+
+	return m.linearStatusModel.Next(status)
+}
+
+// TestNextStatusConcurrent проверяет, что параллельные NextStatus над
+// посылками одного клиента выполняются по очереди: каждая читает статус,
+// записанный предыдущей, и ни один переход не теряется
+func TestNextStatusConcurrent(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}), WithStatusModel(slowStatusModel{}))
+
+	const parcels = 3
+	var numbers []int
+	for i := 0; i < parcels; i++ {
+		parcel, err := service.Register(1000, "Псков")
+		require.NoError(t, err)
+		numbers = append(numbers, parcel.Number)
+	}
+
+	// registered -> sent -> delivered двумя параллельными вызовами
+	var wg sync.WaitGroup
+	errs := make(chan error, parcels*2)
+	for _, number := range numbers {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(number int) {
+				defer wg.Done()
+				errs <- service.NextStatus(number)
+			}(number)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	// check
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	for _, number := range numbers {
+		status, err := store.GetStatus(number)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusDelivered, status)
+	}
+}
+
+// TestClientLocks проверяет, что мьютекс клиента в каждый момент
+// удерживает только одна горутина
+func TestClientLocks(t *testing.T) {
+	locks := newClientLocks()
+
+	var holders, maxHolders int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// клиенты в разном порядке не должны приводить к взаимной блокировке
+			unlock := locks.lock(1, 2)
+			if i%2 == 0 {
+				unlock()
+				unlock = locks.lock(2, 1, 1)
+			}
+			defer unlock()
+
+			n := atomic.AddInt32(&holders, 1)
+			for {
+				max := atomic.LoadInt32(&maxHolders)
+				if n <= max || atomic.CompareAndSwapInt32(&maxHolders, max, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&holders, -1)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), maxHolders)
+}
+
+// TestLockParcelClientMoved проверяет, что если посылку передали другому
+// клиенту, пока ждали мьютекс, захватывается мьютекс нового клиента
+func TestLockParcelClientMoved(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	oldClient := getTestParcel().Client
+	newClient := oldClient + 1
+
+	unlockOld := service.clientLocks.lock(oldClient)
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := service.lockParcelClient(id)
+		if err != nil {
+			unlock = nil
+		}
+		locked <- unlock
+	}()
+	// даём горутине прочитать клиента и встать в ожидание его мьютекса
+	time.Sleep(50 * time.Millisecond)
+
+	// передаём посылку другому клиенту, удерживая его мьютекс
+	_, err = db.Exec("UPDATE parcel SET client = :client WHERE number = :number",
+		sql.Named("client", newClient),
+		sql.Named("number", id))
+	require.NoError(t, err)
+	unlockNew := service.clientLocks.lock(newClient)
+	unlockOld()
+
+	// check
+	select {
+	case <-locked:
+		t.Fatal("захвачен мьютекс прежнего клиента посылки")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockNew()
+	unlock := <-locked
+	require.NotNil(t, unlock)
+	unlock()
+}
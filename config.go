@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// busyTimeoutPragma параметр DSN, с которым соединение при занятой БД
+// ждёт до 5 секунд, прежде чем вернуть SQLITE_BUSY
+const busyTimeoutPragma = "_pragma=busy_timeout(5000)"
+
+// withBusyTimeout добавляет к dsn ожидание занятой БД, если оно ещё
+// не задано. Без него параллельные запросы из разных соединений сразу
+// завершаются ошибкой "database is locked"
+func withBusyTimeout(dsn string) string {
+	if strings.Contains(dsn, "busy_timeout") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + busyTimeoutPragma
+	}
+
+	return dsn + "?" + busyTimeoutPragma
+}
+
+// Config описывает параметры подключения к БД и работы сервиса.
+// Параметры сервиса применяются опцией WithConfig
+type Config struct {
+	// DSN строка подключения к SQLite, например путь к файлу БД
+	DSN string
+	// QueryTimeout ограничивает время каждой операции хранилища,
+	// 0 - без ограничения (см. ParcelStore.WithQueryTimeout)
+	QueryTimeout time.Duration
+	// MaxConcurrentExports ограничивает число одновременных выгрузок
+	// посылок, 0 - без ограничения (см. WithMaxConcurrentExports)
+	MaxConcurrentExports int
+}
+
+var (
+	sharedStoreOnce sync.Once
+	sharedStore     ParcelStore
+	sharedStoreErr  error
+	// sharedStoreMigrate создаёт схему БД в GetStore. Вынесена
+	// в переменную, чтобы тесты могли подсчитать вызовы
+	sharedStoreMigrate = Migrate
+)
+
+// GetStore возвращает общий для всего приложения ParcelStore.
+// При первом вызове открывается БД из cfg и создаётся схема,
+// последующие вызовы возвращают тот же объект (или ту же ошибку)
+// независимо от переданного cfg
+func GetStore(cfg Config) (ParcelStore, error) {
+	sharedStoreOnce.Do(func() {
+		db, err := sql.Open("sqlite", withBusyTimeout(cfg.DSN))
+		if err != nil {
+			sharedStoreErr = err
+			return
+		}
+
+		if err := sharedStoreMigrate(db); err != nil {
+			db.Close()
+			sharedStoreErr = err
+			return
+		}
+
+		sharedStore = NewParcelStore(db).WithQueryTimeout(cfg.QueryTimeout)
+	})
+
+	return sharedStore, sharedStoreErr
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetStoreConcurrent проверяет, что GetStore из разных горутин
+// возвращает один и тот же ParcelStore, а схема создаётся один раз
+func TestGetStoreConcurrent(t *testing.T) {
+	// prepare
+	resetSharedStore()
+	cfg := Config{DSN: filepath.Join(t.TempDir(), "tracker.db")}
+	const workers = 50
+
+	var calls atomic.Int32
+	sharedStoreMigrate = func(db *sql.DB) error {
+		calls.Add(1)
+		return Migrate(db)
+	}
+	t.Cleanup(func() { sharedStoreMigrate = Migrate })
+
+	stores := make([]ParcelStore, workers)
+	errs := make([]error, workers)
+
+	// get
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stores[i], errs[i] = GetStore(cfg)
+		}(i)
+	}
+	wg.Wait()
+
+	// check
+	for i := 0; i < workers; i++ {
+		require.NoError(t, errs[i])
+		require.Same(t, stores[0].db, stores[i].db)
+	}
+
+	require.Equal(t, int32(1), calls.Load())
+
+	var applied int
+	err := stores[0].db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&applied)
+	require.NoError(t, err)
+	require.Equal(t, len(migrations), applied)
+
+	t.Cleanup(resetSharedStore)
+}
+
+// resetSharedStore закрывает БД, открытую GetStore, и сбрасывает общий
+// ParcelStore, чтобы следующий вызов GetStore открыл БД заново
+func resetSharedStore() {
+	if sharedStore.db != nil {
+		sharedStore.db.Close()
+	}
+	sharedStoreOnce = sync.Once{}
+	sharedStore = ParcelStore{}
+	sharedStoreErr = nil
+}
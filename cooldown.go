@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// statusCooldown хранит время последней смены статуса каждой посылки
+// и не даёт менять статус чаще, чем раз в period
+type statusCooldown struct {
+	period time.Duration
+
+	mu   sync.Mutex
+	last map[int]time.Time
+}
+
+func newStatusCooldown(period time.Duration) *statusCooldown {
+	return &statusCooldown{
+		period: period,
+		last:   map[int]time.Time{},
+	}
+}
+
+// allow сообщает, можно ли сейчас менять статус посылки number
+func (c *statusCooldown) allow(number int, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.last[number]
+
+	return !ok || now.Sub(last) >= c.period
+}
+
+// record запоминает now как время последней смены статуса посылки number.
+// Вызывается только после успешной смены, чтобы неудачная попытка
+// не запрещала повторную
+func (c *statusCooldown) record(number int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last[number] = now
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// deleteWhere удаляет посылки, подходящие под условие clause, и возвращает
+// количество удалённых строк. Перед удалением копия каждой строки
+// сохраняется в parcel_deleted, чтобы ошибочно удалённую посылку можно
+// было восстановить, а в changelog записывается операция удаления.
+// Используется Delete и DeleteByNumbers; DeleteAllForClient удаляет
+// данные клиента безвозвратно. Как и в countWhere, clause подставляется в запрос как есть,
+// а значения передаются только через args
+func (s ParcelStore) deleteWhere(clause string, args ...interface{}) (int, error) {
+	deletedAt := time.Now().UTC().Format(time.RFC3339)
+
+	var deleted int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		_, err := tx.q.Exec(`INSERT OR REPLACE INTO parcel_deleted (number, client, status, address, created_at, deleted_at)
+SELECT number, client, status, address, created_at, :deleted_at FROM parcel WHERE `+clause,
+			append(args, sql.Named("deleted_at", deletedAt))...)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChangesWhere(ChangeDelete, clause, args...); err != nil {
+			return err
+		}
+
+		res, err := tx.q.Exec("DELETE FROM parcel WHERE "+clause, args...)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		deleted = int(n)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// GetDeleted возвращает сохранённую копию удалённой посылки.
+// Заполняются только номер, клиент, статус, адрес и время создания
+func (s ParcelStore) GetDeleted(number int) (Parcel, error) {
+	var p Parcel
+	err := s.q.QueryRow("SELECT number, client, status, address, created_at FROM parcel_deleted WHERE number = :number",
+		sql.Named("number", number)).Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Parcel{}, ErrParcelNotFound
+	}
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	return p, nil
+}
+
+// ReRegisterDeleted регистрирует новую посылку с клиентом и адресом
+// ранее удалённой посылки number и возвращает её
+func (s ParcelService) ReRegisterDeleted(number int) (Parcel, error) {
+	deleted, err := s.store.GetDeleted(number)
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	return s.Register(deleted.Client, deleted.Address)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReRegisterDeleted проверяет повторную регистрацию удалённой посылки
+func TestReRegisterDeleted(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}))
+
+	original, err := service.Register(1000, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+
+	// delete
+	require.NoError(t, store.Delete(original.Number))
+	_, err = store.Get(original.Number)
+	require.Error(t, err)
+
+	deleted, err := store.GetDeleted(original.Number)
+	require.NoError(t, err)
+	require.Equal(t, original, deleted)
+
+	// re-register
+	parcel, err := service.ReRegisterDeleted(original.Number)
+	require.NoError(t, err)
+
+	// check
+	require.NotEqual(t, original.Number, parcel.Number)
+	require.Equal(t, original.Client, parcel.Client)
+	require.Equal(t, original.Address, parcel.Address)
+	require.Equal(t, ParcelStatusRegistered, parcel.Status)
+
+	stored, err := store.Get(parcel.Number)
+	require.NoError(t, err)
+	require.Equal(t, original.Client, stored.Client)
+	require.Equal(t, original.Address, stored.Address)
+
+	// посылка, которую не удаляли
+	_, err = service.ReRegisterDeleted(parcel.Number)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
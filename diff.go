@@ -0,0 +1,52 @@
+package main
+
+import "sort"
+
+// ParcelChange посылка, изменившаяся между двумя снимками
+type ParcelChange struct {
+	Old Parcel `json:"old"`
+	New Parcel `json:"new"`
+}
+
+// ParcelDiff разница между двумя снимками посылок. Все списки
+// упорядочены по номеру посылки
+type ParcelDiff struct {
+	Added   []Parcel       `json:"added"`
+	Removed []Parcel       `json:"removed"`
+	Changed []ParcelChange `json:"changed"`
+}
+
+// DiffParcels сравнивает снимки old и new, сопоставляя посылки по номеру:
+// посылки только из new попадают в Added, только из old - в Removed,
+// а посылки из обоих снимков с различающимися полями - в Changed
+func DiffParcels(old, new []Parcel) ParcelDiff {
+	before := make(map[int]Parcel, len(old))
+	for _, p := range old {
+		before[p.Number] = p
+	}
+
+	var diff ParcelDiff
+	seen := make(map[int]bool, len(new))
+	for _, p := range new {
+		seen[p.Number] = true
+
+		prev, ok := before[p.Number]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, p)
+		case prev != p:
+			diff.Changed = append(diff.Changed, ParcelChange{Old: prev, New: p})
+		}
+	}
+	for _, p := range old {
+		if !seen[p.Number] {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Number < diff.Added[j].Number })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Number < diff.Removed[j].Number })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].New.Number < diff.Changed[j].New.Number })
+
+	return diff
+}
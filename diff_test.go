@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiffParcels проверяет сравнение двух снимков посылок
+func TestDiffParcels(t *testing.T) {
+	first := Parcel{Number: 1, Client: 1000, Status: ParcelStatusRegistered, Address: "Псков"}
+	second := Parcel{Number: 2, Client: 1000, Status: ParcelStatusSent, Address: "Москва"}
+	third := Parcel{Number: 3, Client: 2000, Status: ParcelStatusRegistered, Address: "Тверь"}
+
+	sentFirst := first
+	sentFirst.Status = ParcelStatusSent
+	movedThird := third
+	movedThird.Address = "Тула"
+
+	tests := []struct {
+		name     string
+		old      []Parcel
+		new      []Parcel
+		expected ParcelDiff
+	}{
+		{
+			name:     "equal",
+			old:      []Parcel{first, second},
+			new:      []Parcel{second, first},
+			expected: ParcelDiff{},
+		},
+		{
+			name:     "added",
+			old:      []Parcel{first},
+			new:      []Parcel{third, first, second},
+			expected: ParcelDiff{Added: []Parcel{second, third}},
+		},
+		{
+			name:     "removed",
+			old:      []Parcel{third, first, second},
+			new:      []Parcel{second},
+			expected: ParcelDiff{Removed: []Parcel{first, third}},
+		},
+		{
+			name: "changed",
+			old:  []Parcel{first, second, third},
+			new:  []Parcel{movedThird, second, sentFirst},
+			expected: ParcelDiff{Changed: []ParcelChange{
+				{Old: first, New: sentFirst},
+				{Old: third, New: movedThird},
+			}},
+		},
+		{
+			name: "mixed",
+			old:  []Parcel{first, second},
+			new:  []Parcel{sentFirst, third},
+			expected: ParcelDiff{
+				Added:   []Parcel{third},
+				Removed: []Parcel{second},
+				Changed: []ParcelChange{{Old: first, New: sentFirst}},
+			},
+		},
+		{
+			name:     "empty",
+			expected: ParcelDiff{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, DiffParcels(tt.old, tt.new))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNoDeliveries возвращается, когда ещё нет ни одной доставленной посылки,
+	// по которой можно оценить срок доставки
+	ErrNoDeliveries = errors.New("нет доставленных посылок")
+	// ErrAlreadyDelivered возвращается, когда операция не имеет смысла
+	// для уже доставленной посылки
+	ErrAlreadyDelivered = errors.New("посылка уже доставлена")
+)
+
+// AverageDeliveryDuration возвращает среднее время от создания посылки
+// до её доставки по всем доставленным посылкам. Если доставленных
+// посылок нет, возвращается ErrNoDeliveries
+func (s ParcelStore) AverageDeliveryDuration() (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := s.q.QueryRow(`SELECT AVG((julianday(delivered_at) - julianday(created_at)) * 86400)
+FROM parcel WHERE status = :delivered AND delivered_at != ''`,
+		sql.Named("delivered", ParcelStatusDelivered)).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		return 0, ErrNoDeliveries
+	}
+
+	return time.Duration(seconds.Float64 * float64(time.Second)).Round(time.Second), nil
+}
+
+// EstimatedDelivery оценивает дату доставки посылки как время её создания
+// плюс среднее время доставки (см. AverageDeliveryDuration).
+// Для доставленной посылки возвращается ErrAlreadyDelivered
+func (s ParcelService) EstimatedDelivery(number int) (time.Time, error) {
+	parcel, err := s.store.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrParcelNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if parcel.Status == ParcelStatusDelivered {
+		return time.Time{}, ErrAlreadyDelivered
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, parcel.CreatedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	average, err := s.store.AverageDeliveryDuration()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return createdAt.Add(average).UTC(), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEstimatedDelivery проверяет оценку даты доставки по истории доставок
+func TestEstimatedDelivery(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	registered := getTestParcel()
+	registered.CreatedAt = "2024-03-10T10:00:00Z"
+	registeredID, err := store.Add(registered)
+	require.NoError(t, err)
+
+	// без доставленных посылок оценить срок нельзя
+	_, err = service.EstimatedDelivery(registeredID)
+	require.ErrorIs(t, err, ErrNoDeliveries)
+
+	// доставки за 2 и 4 дня
+	deliveries := []struct {
+		createdAt   string
+		deliveredAt string
+	}{
+		{"2024-03-01T09:00:00Z", "2024-03-03T09:00:00Z"},
+		{"2024-03-02T12:00:00Z", "2024-03-06T12:00:00Z"},
+	}
+	var deliveredID int
+	for _, d := range deliveries {
+		parcel := getTestParcel()
+		parcel.Status = ParcelStatusDelivered
+		parcel.CreatedAt = d.createdAt
+		deliveredID, err = store.Add(parcel)
+		require.NoError(t, err)
+
+		_, err = db.Exec("UPDATE parcel SET delivered_at = :delivered_at WHERE number = :number",
+			sql.Named("delivered_at", d.deliveredAt),
+			sql.Named("number", deliveredID))
+		require.NoError(t, err)
+	}
+
+	// check
+	average, err := store.AverageDeliveryDuration()
+	require.NoError(t, err)
+	require.Equal(t, 3*24*time.Hour, average)
+
+	eta, err := service.EstimatedDelivery(registeredID)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, time.March, 13, 10, 0, 0, 0, time.UTC), eta)
+
+	_, err = service.EstimatedDelivery(deliveredID)
+	require.ErrorIs(t, err, ErrAlreadyDelivered)
+
+	_, err = service.EstimatedDelivery(deliveredID + 100)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+)
+
+// типы событий ParcelEvent
+const (
+	EventRegistered    = "registered"
+	EventStatusChanged = "status_changed"
+	EventDeleted       = "deleted"
+)
+
+// eventBufferSize размер буфера канала каждого подписчика
+const eventBufferSize = 64
+
+// ParcelEvent событие об изменении посылки для подписчиков Subscribe
+type ParcelEvent struct {
+	// Type один из EventRegistered, EventStatusChanged, EventDeleted
+	Type string
+	// Parcel посылка после изменения, для EventDeleted - перед удалением
+	Parcel Parcel
+}
+
+// eventHub рассылает события всем подписчикам сервиса
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers []chan ParcelEvent
+}
+
+// publish рассылает событие e подписчикам и, если задано резервное
+// хранилище (см. WithMirror), передаёт в него описанное событием изменение
+func (s ParcelService) publish(e ParcelEvent) {
+	s.events.publish(e)
+	if s.mirror != nil {
+		s.mirror.mirrorEvent(e)
+	}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{}
+}
+
+func (h *eventHub) subscribe() <-chan ParcelEvent {
+	ch := make(chan ParcelEvent, eventBufferSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers = append(h.subscribers, ch)
+
+	return ch
+}
+
+// unsubscribe удаляет подписчика ch и закрывает его канал.
+// Повторный вызов ничего не делает
+func (h *eventHub) unsubscribe(ch <-chan ParcelEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, sub := range h.subscribers {
+		if (<-chan ParcelEvent)(sub) == ch {
+			h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// publish отправляет событие всем подписчикам, не дожидаясь их:
+// если буфер подписчика заполнен, событие для него теряется
+func (h *eventHub) publish(e ParcelEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe возвращает канал, в который приходят события о регистрации,
+// смене статуса и удалении посылок через этот сервис. Канал буферизован,
+// и если подписчик не успевает читать, новые события для него отбрасываются.
+// Когда события больше не нужны, канал освобождается через Unsubscribe
+func (s ParcelService) Subscribe() <-chan ParcelEvent {
+	return s.events.subscribe()
+}
+
+// Unsubscribe отменяет подписку, полученную от Subscribe: события в ch
+// больше не отправляются, а сам канал закрывается, так что чтение
+// из него завершается после уже полученных событий
+func (s ParcelService) Unsubscribe(ch <-chan ParcelEvent) {
+	s.events.unsubscribe(ch)
+}
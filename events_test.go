@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSubscribe проверяет, что подписчик получает события об изменениях посылок
+func TestSubscribe(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}))
+
+	events := service.Subscribe()
+
+	// act
+	sent, err := service.Register(1000, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(sent.Number))
+
+	deleted, err := service.Register(1000, "Москва, Тверская 1")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(deleted.Number))
+
+	// отправленную посылку удалить нельзя, события быть не должно
+	require.NoError(t, service.Delete(sent.Number))
+
+	// check
+	expected := []struct {
+		eventType string
+		number    int
+		status    string
+	}{
+		{EventRegistered, sent.Number, ParcelStatusRegistered},
+		{EventStatusChanged, sent.Number, ParcelStatusSent},
+		{EventRegistered, deleted.Number, ParcelStatusRegistered},
+		{EventDeleted, deleted.Number, ParcelStatusRegistered},
+	}
+	for _, e := range expected {
+		event := <-events
+		require.Equal(t, e.eventType, event.Type)
+		require.Equal(t, e.number, event.Parcel.Number)
+		require.Equal(t, e.status, event.Parcel.Status)
+	}
+	require.Empty(t, events)
+}
+
+// TestSubscribeDropsOnFull проверяет, что переполненный подписчик
+// не блокирует сервис
+func TestSubscribeDropsOnFull(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}))
+
+	events := service.Subscribe()
+
+	// act
+	for i := 0; i < eventBufferSize+5; i++ {
+		_, err := service.Register(1000, "Псков")
+		require.NoError(t, err)
+	}
+
+	// check
+	require.Len(t, events, eventBufferSize)
+}
+
+// TestUnsubscribe проверяет, что после отмены подписки канал закрывается
+// и события в него больше не приходят, а другие подписчики их получают
+func TestUnsubscribe(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}))
+
+	events := service.Subscribe()
+	other := service.Subscribe()
+
+	_, err := service.Register(1000, "Псков")
+	require.NoError(t, err)
+
+	// unsubscribe
+	service.Unsubscribe(events)
+	service.Unsubscribe(events)
+
+	_, err = service.Register(1000, "Псков")
+	require.NoError(t, err)
+
+	// check
+	var received []ParcelEvent
+	for e := range events {
+		received = append(received, e)
+	}
+	require.Len(t, received, 1)
+	require.Len(t, other, 2)
+	require.Len(t, service.events.subscribers, 1)
+}
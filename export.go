@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// defaultProgressEvery через сколько посылок по умолчанию
+// вызывается обработчик прогресса выгрузки
+const defaultProgressEvery = 100
+
+// ErrBusy возвращается, когда уже выполняется максимальное число
+// выгрузок (см. WithMaxConcurrentExports)
+var ErrBusy = errors.New("слишком много одновременных выгрузок")
+
+// acquireExport занимает место для выгрузки и возвращает функцию,
+// освобождающую его. Если свободных мест нет, возвращается ErrBusy
+func (s ParcelService) acquireExport() (release func(), err error) {
+	if s.exports == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.exports <- struct{}{}:
+		return func() { <-s.exports }, nil
+	default:
+		return nil, ErrBusy
+	}
+}
+
+// ExportJSONL записывает в w все посылки в формате JSON Lines:
+// по одному JSON-объекту на строку. Каждая посылка пишется в w сразу
+// после чтения из БД, так что выгрузка не накапливается в памяти
+func (s ParcelService) ExportJSONL(w io.Writer) error {
+	return s.ExportJSONLProgress(w, nil)
+}
+
+// ExportJSONLProgress выгружает посылки так же, как ExportJSONL, и вызывает
+// onProgress с количеством уже выгруженных посылок после каждых N посылок
+// (см. WithProgressEvery), а также в конце выгрузки, если последняя
+// порция оказалась неполной
+func (s ParcelService) ExportJSONLProgress(w io.Writer, onProgress func(done int)) error {
+	release, err := s.acquireExport()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	every := s.progressEvery
+	if every <= 0 {
+		every = defaultProgressEvery
+	}
+
+	enc := json.NewEncoder(w)
+	done := 0
+	err = s.store.ForEach(func(p Parcel) error {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+
+		done++
+		if onProgress != nil && done%every == 0 {
+			onProgress(done)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if onProgress != nil && done%every != 0 {
+		onProgress(done)
+	}
+
+	return nil
+}
+
+// ExportClientCSV записывает в w посылки клиента в формате CSV
+// с заголовком, упорядоченные по номерам посылок
+func (s ParcelService) ExportClientCSV(client int, w io.Writer) error {
+	release, err := s.acquireExport()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	parcels, err := s.store.GetByClient(client)
+	if err != nil {
+		return err
+	}
+	sort.Slice(parcels, func(i, j int) bool { return parcels[i].Number < parcels[j].Number })
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"number", "client", "status", "address", "created_at"}); err != nil {
+		return err
+	}
+	for _, p := range parcels {
+		record := []string{strconv.Itoa(p.Number), strconv.Itoa(p.Client), p.Status, p.Address, p.CreatedAt}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
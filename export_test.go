@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportJSONL проверяет выгрузку посылок в формате JSON Lines
+func TestExportJSONL(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	var parcels []Parcel
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Priority = i%2 == 0
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		parcel.Number = id
+
+		parcels = append(parcels, parcel)
+	}
+
+	// export
+	var buf bytes.Buffer
+	err := service.ExportJSONL(&buf)
+	require.NoError(t, err)
+
+	// check
+	var exported []Parcel
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var parcel Parcel
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &parcel))
+		exported = append(exported, parcel)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, parcels, exported)
+}
+
+// TestExportJSONLProgress проверяет вызовы обработчика прогресса выгрузки
+func TestExportJSONLProgress(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithProgressEvery(3))
+
+	for i := 0; i < 7; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// export
+	var progress []int
+	var buf bytes.Buffer
+	err := service.ExportJSONLProgress(&buf, func(done int) {
+		progress = append(progress, done)
+	})
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, []int{3, 6, 7}, progress)
+	require.Equal(t, 7, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+// TestExportClientCSV проверяет выгрузку посылок клиента в CSV
+func TestExportClientCSV(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	first, err := service.Register(1000, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+	second, err := service.Register(1000, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+	_, err = service.Register(1001, "Тверь")
+	require.NoError(t, err)
+
+	// export
+	var buf bytes.Buffer
+	require.NoError(t, service.ExportClientCSV(1000, &buf))
+
+	// check
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"number", "client", "status", "address", "created_at"},
+		{strconv.Itoa(first.Number), "1000", ParcelStatusRegistered, first.Address, first.CreatedAt},
+		{strconv.Itoa(second.Number), "1000", ParcelStatusRegistered, second.Address, second.CreatedAt},
+	}, records)
+}
+
+// blockingWriter сообщает в started о начале записи и ждёт закрытия release
+type blockingWriter struct {
+	started chan<- struct{}
+	release <-chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		w.started <- struct{}{}
+		<-w.release
+	})
+
+	return len(p), nil
+}
+
+// TestExportThrottle проверяет, что выгрузки сверх лимита отклоняются
+func TestExportThrottle(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithConfig(Config{MaxConcurrentExports: 2}))
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	// занимаем все места выгрузками, которые ждут release
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.ExportJSONL(&blockingWriter{started: started, release: release})
+		}(i)
+	}
+	for range errs {
+		<-started
+	}
+
+	// check
+	err = service.ExportJSONL(io.Discard)
+	require.ErrorIs(t, err, ErrBusy)
+	err = service.ExportClientCSV(1000, io.Discard)
+	require.ErrorIs(t, err, ErrBusy)
+
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, service.ExportJSONL(io.Discard))
+	require.NoError(t, service.ExportClientCSV(1000, io.Discard))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Fingerprint возвращает SHA-256 в шестнадцатеричном виде от канонического
+// представления посылки: всех полей в фиксированном порядке, каждое
+// в виде имя=значение. Одинаковые посылки дают одинаковый отпечаток,
+// изменение любого поля меняет его
+func (p Parcel) Fingerprint() string {
+	h := sha256.New()
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"number", p.Number},
+		{"client", p.Client},
+		{"status", p.Status},
+		{"address", p.Address},
+		{"created_at", p.CreatedAt},
+		{"priority", p.Priority},
+		{"attempts", p.Attempts},
+		{"version", p.Version},
+		{"weight_grams", p.WeightGrams},
+		{"length_mm", p.LengthMM},
+		{"width_mm", p.WidthMM},
+		{"height_mm", p.HeightMM},
+		{"claimed_by", p.ClaimedBy},
+		{"claimed_at", p.ClaimedAt},
+	}
+	for _, f := range fields {
+		// %q экранирует строки, так что значение не может подделать
+		// разделитель или следующее поле
+		fmt.Fprintf(h, "%s=%q\n", f.name, fmt.Sprint(f.value))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
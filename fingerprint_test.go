@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFingerprint проверяет, что отпечаток зависит только от значений полей
+func TestFingerprint(t *testing.T) {
+	base := Parcel{
+		Number:      1,
+		Client:      1000,
+		Status:      ParcelStatusRegistered,
+		Address:     "Псков, ул. Колотушкина, д. 5",
+		CreatedAt:   "2024-03-01T12:00:00Z",
+		Priority:    true,
+		Attempts:    1,
+		Version:     2,
+		WeightGrams: 500,
+		LengthMM:    100,
+		WidthMM:     200,
+		HeightMM:    300,
+		ClaimedBy:   "worker-1",
+		ClaimedAt:   "2024-03-01T13:00:00Z",
+	}
+
+	fingerprint := base.Fingerprint()
+	require.Len(t, fingerprint, 64)
+
+	same := base
+	require.Equal(t, fingerprint, same.Fingerprint())
+
+	tests := []struct {
+		name   string
+		change func(p *Parcel)
+	}{
+		{name: "number", change: func(p *Parcel) { p.Number++ }},
+		{name: "client", change: func(p *Parcel) { p.Client++ }},
+		{name: "status", change: func(p *Parcel) { p.Status = ParcelStatusSent }},
+		{name: "address", change: func(p *Parcel) { p.Address += " " }},
+		{name: "created_at", change: func(p *Parcel) { p.CreatedAt = "2024-03-02T12:00:00Z" }},
+		{name: "priority", change: func(p *Parcel) { p.Priority = false }},
+		{name: "attempts", change: func(p *Parcel) { p.Attempts++ }},
+		{name: "version", change: func(p *Parcel) { p.Version++ }},
+		{name: "weight", change: func(p *Parcel) { p.WeightGrams++ }},
+		{name: "length", change: func(p *Parcel) { p.LengthMM++ }},
+		{name: "width", change: func(p *Parcel) { p.WidthMM++ }},
+		{name: "height", change: func(p *Parcel) { p.HeightMM++ }},
+		{name: "claimed_by", change: func(p *Parcel) { p.ClaimedBy = "" }},
+		{name: "claimed_at", change: func(p *Parcel) { p.ClaimedAt = "" }},
+		{name: "swapped values", change: func(p *Parcel) { p.LengthMM, p.WidthMM = p.WidthMM, p.LengthMM }},
+		{name: "shifted text", change: func(p *Parcel) {
+			p.Address = base.Address + "\nstatus=" + base.Status
+			p.Status = ""
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := base
+			tt.change(&changed)
+			require.NotEqual(t, fingerprint, changed.Fingerprint())
+		})
+	}
+}
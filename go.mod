@@ -4,6 +4,7 @@ go 1.21
 
 require (
 	github.com/stretchr/testify v1.8.4
+	google.golang.org/protobuf v1.34.2
 	modernc.org/sqlite v1.27.0
 )
 
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNoHistory возвращается, когда у посылки нет ни одной записи в истории статусов
+var ErrNoHistory = errors.New("у посылки нет истории статусов")
+
+// HistoryEntry запись истории статусов посылки
+type HistoryEntry struct {
+	Status    string `json:"status"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// History возвращает историю статусов посылки в хронологическом порядке
+func (s ParcelStore) History(number int) ([]HistoryEntry, error) {
+	rows, err := s.q.Query("SELECT status, changed_at FROM parcel_history WHERE number = :number ORDER BY changed_at ASC, id ASC",
+		sql.Named("number", number))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		if err := rows.Scan(&e.Status, &e.ChangedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// addHistory добавляет в parcel_history запись о переходе посылки в статус status.
+// Если последняя запись истории уже с этим статусом, новая не добавляется
+func (s ParcelStore) addHistory(number int, status, changedAt string) error {
+	_, err := s.q.Exec(`INSERT INTO parcel_history (number, status, changed_at)
+SELECT :number, :status, :changed_at
+WHERE COALESCE((SELECT status FROM parcel_history WHERE number = :number ORDER BY changed_at DESC, id DESC LIMIT 1), '') != :status`,
+		sql.Named("number", number),
+		sql.Named("status", status),
+		sql.Named("changed_at", changedAt))
+
+	return err
+}
+
+// addHistoryIfUpdated вызывает addHistory, только если запрос res изменил строку,
+// то есть посылка существует
+func (s ParcelStore) addHistoryIfUpdated(res sql.Result, number int, status, changedAt string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	return s.addHistory(number, status, changedAt)
+}
+
+// CompactHistory удаляет из истории посылки записи, повторяющие статус
+// предыдущей записи, и возвращает количество удалённых записей
+func (s ParcelStore) CompactHistory(number int) (int, error) {
+	var removed int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		rows, err := tx.q.Query("SELECT id, status FROM parcel_history WHERE number = :number ORDER BY changed_at ASC, id ASC",
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		var duplicates []int
+		prev := ""
+		for rows.Next() {
+			var id int
+			var status string
+			if err := rows.Scan(&id, &status); err != nil {
+				rows.Close()
+				return err
+			}
+			if status == prev {
+				duplicates = append(duplicates, id)
+			}
+			prev = status
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range duplicates {
+			if _, err := tx.q.Exec("DELETE FROM parcel_history WHERE id = :id", sql.Named("id", id)); err != nil {
+				return err
+			}
+		}
+		removed = len(duplicates)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// RecomputeStatus восстанавливает статус посылки по последней записи
+// в истории статусов и возвращает исправленное значение
+func (s ParcelStore) RecomputeStatus(number int) (string, error) {
+	var status string
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		if _, err := tx.GetStatus(number); err != nil {
+			return err
+		}
+
+		var changedAt string
+		err := tx.q.QueryRow("SELECT status, changed_at FROM parcel_history WHERE number = :number ORDER BY changed_at DESC, id DESC LIMIT 1",
+			sql.Named("number", number)).Scan(&status, &changedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoHistory
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.q.Exec("UPDATE parcel SET status = :status, status_changed_at = :changed_at, version = version + 1 WHERE number = :number",
+			sql.Named("status", status),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", number))
+
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
+
+// DwellTimes возвращает, сколько времени посылка провела в каждом статусе,
+// по интервалам между соседними записями истории. Текущий статус
+// в результат не входит, так как его интервал ещё не закончился.
+// Если посылка возвращалась в статус повторно, интервалы суммируются
+func (s ParcelStore) DwellTimes(number int) (map[string]time.Duration, error) {
+	dwell := map[string]time.Duration{}
+	err := s.inTx(&sql.TxOptions{ReadOnly: true}, func(tx ParcelStore) error {
+		if _, err := tx.GetStatus(number); err != nil {
+			return err
+		}
+
+		rows, err := tx.q.Query("SELECT status, changed_at FROM parcel_history WHERE number = :number ORDER BY changed_at ASC, id ASC",
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var prevStatus string
+		var prevAt time.Time
+		for rows.Next() {
+			var status, changedAt string
+			if err := rows.Scan(&status, &changedAt); err != nil {
+				return err
+			}
+			at, err := time.Parse(time.RFC3339, changedAt)
+			if err != nil {
+				return err
+			}
+
+			if prevStatus != "" {
+				dwell[prevStatus] += at.Sub(prevAt)
+			}
+			prevStatus, prevAt = status, at
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if prevStatus == "" {
+			return ErrNoHistory
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dwell, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecomputeStatus проверяет восстановление статуса по истории
+func TestRecomputeStatus(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	// corrupt status
+	_, err = db.Exec("UPDATE parcel SET status = 'delivered' WHERE number = :number", sql.Named("number", id))
+	require.NoError(t, err)
+
+	// recompute
+	status, err := store.RecomputeStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	// check
+	status, err = store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	_, err = store.RecomputeStatus(id + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestDwellTimes проверяет расчёт времени пребывания посылки в статусах
+func TestDwellTimes(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// заменяем историю записями с известным временем
+	_, err = db.Exec("DELETE FROM parcel_history WHERE number = :number", sql.Named("number", id))
+	require.NoError(t, err)
+
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	history := []struct {
+		status string
+		after  time.Duration
+	}{
+		{ParcelStatusRegistered, 0},
+		{ParcelStatusSent, 2 * time.Hour},
+		{ParcelStatusFailed, 26 * time.Hour},
+		{ParcelStatusRegistered, 27 * time.Hour},
+		{ParcelStatusSent, 27*time.Hour + 30*time.Minute},
+		{ParcelStatusDelivered, 50 * time.Hour},
+	}
+	for _, h := range history {
+		require.NoError(t, store.addHistory(id, h.status, start.Add(h.after).Format(time.RFC3339)))
+	}
+
+	// check
+	dwell, err := store.DwellTimes(id)
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		ParcelStatusRegistered: 2*time.Hour + 30*time.Minute,
+		ParcelStatusSent:       24*time.Hour + 22*time.Hour + 30*time.Minute,
+		ParcelStatusFailed:     time.Hour,
+	}, dwell)
+
+	_, err = store.DwellTimes(id + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestCompactHistory проверяет удаление повторяющихся записей истории
+func TestCompactHistory(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// повторная установка того же статуса не пишет историю
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	history, err := store.History(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	// заменяем историю записями с повторами
+	_, err = db.Exec("DELETE FROM parcel_history WHERE number = :number", sql.Named("number", id))
+	require.NoError(t, err)
+
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	statuses := []string{
+		ParcelStatusRegistered,
+		ParcelStatusRegistered,
+		ParcelStatusSent,
+		ParcelStatusSent,
+		ParcelStatusSent,
+		ParcelStatusRegistered,
+		ParcelStatusSent,
+	}
+	for i, status := range statuses {
+		_, err := db.Exec("INSERT INTO parcel_history (number, status, changed_at) VALUES (:number, :status, :changed_at)",
+			sql.Named("number", id),
+			sql.Named("status", status),
+			sql.Named("changed_at", start.Add(time.Duration(i)*time.Hour).Format(time.RFC3339)))
+		require.NoError(t, err)
+	}
+
+	// compact
+	removed, err := store.CompactHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+
+	// check
+	history, err = store.History(id)
+	require.NoError(t, err)
+	var compacted []string
+	for _, h := range history {
+		compacted = append(compacted, h.Status)
+	}
+	require.Equal(t, []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusSent}, compacted)
+	require.Equal(t, start.Format(time.RFC3339), history[0].ChangedAt)
+	require.Equal(t, start.Add(2*time.Hour).Format(time.RFC3339), history[1].ChangedAt)
+
+	removed, err = store.CompactHistory(id)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+}
+
+// TestSetStatusSameStatus проверяет, что повторная установка того же
+// статуса не меняет посылку и не пишет историю и журнал изменений
+func TestSetStatusSameStatus(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	sent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+	delivered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusDelivered))
+
+	// посылки сменили статус двое суток назад
+	longAgo := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	_, err = db.Exec("UPDATE parcel SET status_changed_at = :at, delivered_at = CASE WHEN delivered_at != '' THEN :at ELSE '' END",
+		sql.Named("at", longAgo))
+	require.NoError(t, err)
+
+	before := map[int]Parcel{}
+	for _, id := range []int{sent, delivered} {
+		before[id], err = store.Get(id)
+		require.NoError(t, err)
+	}
+	changes, err := store.RecentChanges(0)
+	require.NoError(t, err)
+
+	// repeat
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusDelivered))
+	version, err := store.SetStatusCAS(sent, before[sent].Version, ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, before[sent].Version, version)
+
+	// check
+	for _, id := range []int{sent, delivered} {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, before[id], stored)
+
+		history, err := store.History(id)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+	}
+
+	stuck, err := store.StuckInSent(time.Now().Add(-24 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	require.Equal(t, sent, stuck[0].Number)
+
+	var deliveredAt string
+	require.NoError(t, db.QueryRow("SELECT delivered_at FROM parcel WHERE number = :number",
+		sql.Named("number", delivered)).Scan(&deliveredAt))
+	require.Equal(t, longAgo, deliveredAt)
+
+	after, err := store.RecentChanges(0)
+	require.NoError(t, err)
+	require.Equal(t, changes, after)
+}
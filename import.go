@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedCSVRow возвращается, когда строку CSV нельзя разобрать
+// как пару клиент, адрес
+var ErrMalformedCSVRow = errors.New("некорректная строка CSV")
+
+// ImportCSV регистрирует посылки из CSV со строками вида "клиент,адрес"
+// и возвращает количество зарегистрированных посылок. Все посылки
+// добавляются в одной транзакции. Некорректные строки по умолчанию
+// прерывают импорт, ничего не добавив, а с WithSkipMalformedRows(true)
+// пропускаются. Ошибка чтения из r всегда прерывает импорт. На время
+// добавления, как и Register, удерживаются мьютексы клиентов посылок
+func (s ParcelService) ImportCSV(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	// количество полей проверяем сами, чтобы такие строки можно было пропустить
+	reader.FieldsPerRecord = -1
+
+	createdAt := s.clock.Now().UTC().Format(time.RFC3339)
+
+	var parcels []Parcel
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var line int
+		var parcel Parcel
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			line = parseErr.Line
+		case err != nil:
+			// ошибка чтения не относится к строке и не пропускается,
+			// иначе она повторялась бы бесконечно
+			return 0, err
+		default:
+			line, _ = reader.FieldPos(0)
+			parcel, err = parseCSVParcel(record)
+			if err == nil {
+				err = s.addressValidator.Validate(parcel.Address)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("строка %d: %w: %w", line, ErrMalformedCSVRow, err)
+			if !s.skipMalformed {
+				return 0, err
+			}
+			s.logger.Printf("Импорт CSV: %v, строка пропущена\n", err)
+			continue
+		}
+
+		parcel.CreatedAt = createdAt
+		parcels = append(parcels, parcel)
+	}
+
+	clients := make([]int, 0, len(parcels))
+	for _, parcel := range parcels {
+		clients = append(clients, parcel.Client)
+	}
+	unlock := s.clientLocks.lock(clients...)
+	defer unlock()
+
+	err := s.store.WithTx(func(tx ParcelStore) error {
+		for i := range parcels {
+			id, err := tx.Add(parcels[i])
+			if err != nil {
+				return err
+			}
+			parcels[i].Number = id
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, parcel := range parcels {
+		s.publish(ParcelEvent{Type: EventRegistered, Parcel: parcel})
+	}
+
+	s.logger.Printf("Импорт CSV: зарегистрировано посылок: %d\n", len(parcels))
+
+	return len(parcels), nil
+}
+
+// parseCSVParcel разбирает строку CSV "клиент,адрес" в новую посылку
+func parseCSVParcel(record []string) (Parcel, error) {
+	if len(record) != 2 {
+		return Parcel{}, fmt.Errorf("ожидалось 2 поля, получено %d", len(record))
+	}
+
+	client, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	address, err := normalizeAddress(record[1])
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	return Parcel{
+		Client:  client,
+		Status:  ParcelStatusRegistered,
+		Address: address,
+	}, nil
+}
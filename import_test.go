@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestImportCSV проверяет регистрацию посылок из корректного CSV
+func TestImportCSV(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	now := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}), WithClock(fixedClock{now: now}))
+
+	input := `1000,"Псков, ул. Колотушкина, д. 5"
+1000,"  Москва,
+   Тверская 1"
+2000,Казань
+`
+
+	// import
+	n, err := service.ImportCSV(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	// check
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.ElementsMatch(t, []string{"Псков, ул. Колотушкина, д. 5", "Москва, Тверская 1"},
+		[]string{parcels[0].Address, parcels[1].Address})
+	for _, parcel := range parcels {
+		require.Equal(t, ParcelStatusRegistered, parcel.Status)
+		require.Equal(t, now.Format(time.RFC3339), parcel.CreatedAt)
+	}
+
+	count, err := store.CountByClient(2000)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+// TestImportCSVMalformed проверяет обработку некорректной строки:
+// по умолчанию импорт прерывается целиком, а с WithSkipMalformedRows
+// строка пропускается
+func TestImportCSVMalformed(t *testing.T) {
+	input := `1000,"Псков,
+ул. Колотушкина"
+abc,Москва
+2000,Казань
+`
+
+	t.Run("error", func(t *testing.T) {
+		db := setupDB(t)
+		store := NewParcelStore(db)
+		service := NewParcelService(store, WithLogger(&recordingLogger{}))
+
+		n, err := service.ImportCSV(strings.NewReader(input))
+		require.ErrorIs(t, err, ErrMalformedCSVRow)
+		require.ErrorContains(t, err, "строка 3")
+		require.Zero(t, n)
+
+		total, err := store.Total()
+		require.NoError(t, err)
+		require.Zero(t, total)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		db := setupDB(t)
+		store := NewParcelStore(db)
+		logger := &recordingLogger{}
+		service := NewParcelService(store, WithLogger(logger), WithSkipMalformedRows(true))
+
+		n, err := service.ImportCSV(strings.NewReader(input + "3000\n4000,\n"))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		total, err := store.Total()
+		require.NoError(t, err)
+		require.Equal(t, 2, total)
+		require.Len(t, logger.lines, 4)
+	})
+}
+
+// TestImportCSVReadError проверяет, что ошибка чтения прерывает импорт
+// и не считается некорректной строкой, даже если такие строки пропускаются
+func TestImportCSVReadError(t *testing.T) {
+	errRead := errors.New("ошибка чтения")
+
+	for _, skip := range []bool{false, true} {
+		// prepare
+		db := setupDB(t)
+		store := NewParcelStore(db)
+		service := NewParcelService(store, WithLogger(&recordingLogger{}), WithSkipMalformedRows(skip))
+		r := io.MultiReader(strings.NewReader("1000,Москва\n"), iotest.ErrReader(errRead))
+
+		// import
+		type result struct {
+			n   int
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			n, err := service.ImportCSV(r)
+			done <- result{n, err}
+		}()
+
+		// check
+		select {
+		case res := <-done:
+			require.ErrorIs(t, res.err, errRead)
+			require.NotErrorIs(t, res.err, ErrMalformedCSVRow)
+			require.Zero(t, res.n)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("импорт с пропуском строк %v не завершился", skip)
+		}
+
+		total, err := store.Total()
+		require.NoError(t, err)
+		require.Zero(t, total)
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -12,45 +15,230 @@ const (
 	ParcelStatusRegistered = "registered"
 	ParcelStatusSent       = "sent"
 	ParcelStatusDelivered  = "delivered"
+	ParcelStatusFailed     = "failed"
+	ParcelStatusProcessing = "processing"
 )
 
+// parcelStatuses все статусы посылки
+var parcelStatuses = []string{
+	ParcelStatusRegistered,
+	ParcelStatusProcessing,
+	ParcelStatusSent,
+	ParcelStatusDelivered,
+	ParcelStatusFailed,
+}
+
+var (
+	// ErrInvalidTransition возвращается, когда запрошенный статус
+	// не является следующим допустимым для текущего статуса посылки
+	ErrInvalidTransition = errors.New("недопустимый переход статуса")
+	// ErrTooSoon возвращается, когда статус посылки пытаются сменить
+	// раньше, чем истёк интервал после предыдущей смены
+	ErrTooSoon = errors.New("статус посылки менялся слишком недавно")
+	// ErrUnknownStatus возвращается для строки, не соответствующей ни одному статусу
+	ErrUnknownStatus = errors.New("неизвестный статус посылки")
+	// ErrUnknownEvent возвращается для неизвестного события сканера
+	ErrUnknownEvent = errors.New("неизвестное событие сканирования")
+	// ErrMissingAddress возвращается при попытке отправить посылку без адреса
+	ErrMissingAddress = errors.New("у посылки не указан адрес")
+	// ErrNumberOutOfRange возвращается, когда присвоенный посылке номер
+	// не входит в диапазон, выделенный партнёру
+	ErrNumberOutOfRange = errors.New("номер посылки вне допустимого диапазона")
+)
+
+// scanEventStatuses задаёт статус, в который переходит посылка
+// при получении события от сканера на складе
+var scanEventStatuses = map[string]string{
+	"dispatched": ParcelStatusSent,
+	"delivered":  ParcelStatusDelivered,
+}
+
 type Parcel struct {
-	Number    int
-	Client    int
-	Status    string
-	Address   string
-	CreatedAt string
+	Number    int    `json:"number"`
+	Client    int    `json:"client"`
+	Status    string `json:"status"`
+	Address   string `json:"address"`
+	CreatedAt string `json:"created_at"`
+	Priority  bool   `json:"priority"`
+	Attempts  int    `json:"attempts"`
+	Version   int    `json:"version"`
+	// вес и габариты посылки, 0 - не измерялись
+	WeightGrams int `json:"weight_grams"`
+	LengthMM    int `json:"length_mm"`
+	WidthMM     int `json:"width_mm"`
+	HeightMM    int `json:"height_mm"`
+	// ClaimedBy обработчик, взявший посылку в работу (см. ClaimNext),
+	// ClaimedAt время, когда это произошло
+	ClaimedBy string `json:"claimed_by"`
+	ClaimedAt string `json:"claimed_at"`
 }
 
 type ParcelService struct {
-	store ParcelStore
+	store    ParcelStore
+	logger   Logger
+	clock    Clock
+	model    StatusModel
+	cooldown *statusCooldown
+	notifier DeliveryNotifier
+	// progressEvery через сколько посылок сообщать о прогрессе выгрузки
+	progressEvery int
+	// skipMalformed пропускать ли некорректные строки при импорте CSV
+	skipMalformed bool
+	events        *eventHub
+	// clientLocks упорядочивает изменения посылок одного клиента
+	clientLocks *clientLocks
+	// addressValidator проверяет адреса при регистрации и смене адреса
+	addressValidator AddressValidator
+	// exports семафор одновременных выгрузок, nil - без ограничения
+	exports chan struct{}
+	// mirror дублирует изменения в резервное хранилище, nil - не дублировать
+	mirror *MirrorStore
 }
 
-func NewParcelService(store ParcelStore) ParcelService {
-	return ParcelService{store: store}
+func NewParcelService(store ParcelStore, opts ...ServiceOption) ParcelService {
+	s := ParcelService{
+		store:            store,
+		logger:           stdoutLogger{},
+		clock:            realClock{},
+		model:            linearStatusModel{},
+		events:           newEventHub(),
+		clientLocks:      newClientLocks(),
+		addressValidator: permissiveValidator{},
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if s.mirror != nil {
+		mirror := NewMirrorStore(s.store, s.mirror.secondary, s.logger)
+		s.mirror = &mirror
+	}
+
+	return s
 }
 
 func (s ParcelService) Register(client int, address string) (Parcel, error) {
+	return s.register(client, address, nil)
+}
+
+// RegisterInRange регистрирует посылку так же, как Register, но только если
+// присвоенный ей номер попал в диапазон [min, max], выделенный партнёру.
+// Иначе регистрация отменяется и возвращается ErrNumberOutOfRange
+func (s ParcelService) RegisterInRange(client int, address string, min, max int) (Parcel, error) {
+	if min > max {
+		return Parcel{}, ErrInvalidRange
+	}
+
+	return s.register(client, address, func(number int) error {
+		if number < min || number > max {
+			return fmt.Errorf("%w: %d не входит в [%d, %d]", ErrNumberOutOfRange, number, min, max)
+		}
+		return nil
+	})
+}
+
+// register регистрирует посылку клиента. Если задана check, она вызывается
+// с присвоенным номером в той же транзакции, и её ошибка отменяет регистрацию
+func (s ParcelService) register(client int, address string, check func(number int) error) (Parcel, error) {
+	address, err := s.prepareAddress(address)
+	if err != nil {
+		return Parcel{}, err
+	}
+
 	parcel := Parcel{
 		Client:    client,
 		Status:    ParcelStatusRegistered,
 		Address:   address,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		CreatedAt: s.clock.Now().UTC().Format(time.RFC3339),
 	}
 
-	id, err := s.store.Add(parcel)
+	unlock := s.clientLocks.lock(client)
+	defer unlock()
+
+	var id int
+	err = s.store.WithTx(func(tx ParcelStore) error {
+		id, err = tx.Add(parcel)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			return check(id)
+		}
+
+		return nil
+	})
 	if err != nil {
 		return parcel, err
 	}
 
 	parcel.Number = id
 
-	fmt.Printf("Новая посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s\n",
+	s.logger.Printf("Новая посылка № %d на адрес %s от клиента с идентификатором %d зарегистрирована %s\n",
 		parcel.Number, parcel.Address, parcel.Client, parcel.CreatedAt)
+	s.publish(ParcelEvent{Type: EventRegistered, Parcel: parcel})
 
 	return parcel, nil
 }
 
+// RegisterBatchDedup в одной транзакции регистрирует посылки клиента
+// на адреса addresses, пропуская адреса, на которые у клиента уже есть
+// зарегистрированная посылка, в том числе из этого же списка.
+// Возвращает созданные посылки и пропущенные адреса. Если хотя бы один
+// адрес некорректен, ничего не регистрируется
+func (s ParcelService) RegisterBatchDedup(client int, addresses []string) (created []Parcel, skipped []string, err error) {
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		address, err := s.prepareAddress(address)
+		if err != nil {
+			return nil, nil, err
+		}
+		normalized = append(normalized, address)
+	}
+
+	createdAt := s.clock.Now().UTC().Format(time.RFC3339)
+
+	unlock := s.clientLocks.lock(client)
+	defer unlock()
+
+	err = s.store.WithTx(func(tx ParcelStore) error {
+		for _, address := range normalized {
+			duplicate, err := tx.HasActiveDuplicate(client, address)
+			if err != nil {
+				return err
+			}
+			if duplicate {
+				skipped = append(skipped, address)
+				continue
+			}
+
+			parcel := Parcel{
+				Client:    client,
+				Status:    ParcelStatusRegistered,
+				Address:   address,
+				CreatedAt: createdAt,
+			}
+			parcel.Number, err = tx.Add(parcel)
+			if err != nil {
+				return err
+			}
+			created = append(created, parcel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, parcel := range created {
+		s.publish(ParcelEvent{Type: EventRegistered, Parcel: parcel})
+	}
+
+	s.logger.Printf("Пакетная регистрация: клиент %d, зарегистрировано посылок: %d, пропущено дубликатов: %d\n",
+		client, len(created), len(skipped))
+
+	return created, skipped, nil
+}
+
 func (s ParcelService) PrintClientParcels(client int) error {
 	parcels, err := s.store.GetByClient(client)
 	if err != nil {
@@ -68,39 +256,403 @@ func (s ParcelService) PrintClientParcels(client int) error {
 }
 
 func (s ParcelService) NextStatus(number int) error {
+	unlock, err := s.lockParcelClient(number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	parcel, err := s.store.Get(number)
 	if err != nil {
 		return err
 	}
 
-	var nextStatus string
-	switch parcel.Status {
-	case ParcelStatusRegistered:
-		nextStatus = ParcelStatusSent
-	case ParcelStatusSent:
-		nextStatus = ParcelStatusDelivered
-	case ParcelStatusDelivered:
+	nextStatus, ok := s.model.Next(parcel.Status)
+	if !ok {
 		return nil
 	}
+	if err := checkDispatch(parcel, nextStatus); err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	if s.cooldown != nil && !s.cooldown.allow(number, now) {
+		return ErrTooSoon
+	}
+
+	if err := s.setStatus(parcel, nextStatus); err != nil {
+		return err
+	}
+	if s.cooldown != nil {
+		s.cooldown.record(number, now)
+	}
+
+	return nil
+}
+
+// SetStatusValidated переводит посылку в статус target, если он является
+// следующим допустимым для её текущего статуса, иначе возвращает ErrInvalidTransition
+func (s ParcelService) SetStatusValidated(number int, target string) error {
+	target, err := ParseStatus(target)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransition, err)
+	}
+
+	unlock, err := s.lockParcelClient(number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	parcel, err := s.store.Get(number)
+	if err != nil {
+		return err
+	}
+
+	nextStatus, ok := s.model.Next(parcel.Status)
+	if !ok || nextStatus != target {
+		return ErrInvalidTransition
+	}
+	if err := checkDispatch(parcel, nextStatus); err != nil {
+		return err
+	}
+
+	return s.setStatus(parcel, nextStatus)
+}
+
+// checkDispatch проверяет, что посылку можно перевести в статус status:
+// отправить посылку без адреса нельзя
+func checkDispatch(parcel Parcel, status string) error {
+	if status == ParcelStatusSent && strings.TrimSpace(parcel.Address) == "" {
+		return ErrMissingAddress
+	}
+
+	return nil
+}
+
+// setStatus сохраняет новый статус посылки и, если она доставлена,
+// уведомляет об этом notifier. Ошибка уведомления только выводится,
+// так как статус к этому моменту уже сохранён
+func (s ParcelService) setStatus(parcel Parcel, status string) error {
+	s.logger.Printf("У посылки № %d новый статус: %s\n", parcel.Number, status)
+
+	err := s.store.SetStatus(parcel.Number, status)
+	if err != nil {
+		return err
+	}
+	parcel.Status = status
+	s.statusChanged(parcel)
+
+	return nil
+}
+
+// statusChanged публикует событие о сохранённой смене статуса посылки
+// и, если она доставлена, уведомляет об этом notifier
+func (s ParcelService) statusChanged(parcel Parcel) {
+	s.publish(ParcelEvent{Type: EventStatusChanged, Parcel: parcel})
+
+	if parcel.Status == ParcelStatusDelivered && s.notifier != nil {
+		if err := s.notifier.NotifyDelivered(parcel); err != nil {
+			s.logger.Printf("Не удалось отправить уведомление о доставке посылки № %d: %v\n", parcel.Number, err)
+		}
+	}
+}
+
+// SetStatusBatchAtomic в одной транзакции переводит посылки в статусы из
+// changes (ключ - номер посылки, значение - целевой статус). Каждый переход
+// проверяется, как в SetStatusValidated, и если хотя бы один недопустим,
+// не меняется ни одна посылка
+func (s ParcelService) SetStatusBatchAtomic(changes map[int]string) error {
+	numbers := make([]int, 0, len(changes))
+	for number := range changes {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	unlock, err := s.lockParcelClients(numbers)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var changed []Parcel
+	err = s.store.WithTx(func(tx ParcelStore) error {
+		// сначала проверяем все переходы, и только если они допустимы,
+		// меняем статусы
+		for _, number := range numbers {
+			target, err := ParseStatus(changes[number])
+			if err != nil {
+				return fmt.Errorf("посылка %d: %w: %w", number, ErrInvalidTransition, err)
+			}
+
+			parcel, err := tx.Get(number)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("посылка %d: %w", number, ErrParcelNotFound)
+			}
+			if err != nil {
+				return err
+			}
+
+			nextStatus, ok := s.model.Next(parcel.Status)
+			if !ok || nextStatus != target {
+				return fmt.Errorf("посылка %d: %w", number, ErrInvalidTransition)
+			}
+			if err := checkDispatch(parcel, target); err != nil {
+				return fmt.Errorf("посылка %d: %w", number, err)
+			}
+
+			parcel.Status = target
+			changed = append(changed, parcel)
+		}
+
+		for _, parcel := range changed {
+			if err := tx.SetStatus(parcel.Number, parcel.Status); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, parcel := range changed {
+		s.logger.Printf("У посылки № %d новый статус: %s\n", parcel.Number, parcel.Status)
+		s.statusChanged(parcel)
+	}
 
-	fmt.Printf("У посылки № %d новый статус: %s\n", number, nextStatus)
+	return nil
+}
+
+// ParseStatus приводит строку к одному из статусов посылки без учёта
+// регистра и пробелов по краям, для прочих строк возвращает ErrUnknownStatus
+func ParseStatus(status string) (string, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered, ParcelStatusFailed, ParcelStatusProcessing:
+		return status, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownStatus, status)
+}
+
+// StatusModel описывает допустимые переходы между статусами посылки
+type StatusModel interface {
+	// Next возвращает статус, следующий за status;
+	// ok равен false, если перейти дальше нельзя
+	Next(status string) (next string, ok bool)
+}
+
+// linearStatusModel модель по умолчанию: registered -> sent -> delivered
+type linearStatusModel struct{}
+
+func (linearStatusModel) Next(status string) (string, bool) {
+	return nextParcelStatus(status)
+}
+
+// RecordScanEvent переводит посылку в статус, соответствующий событию
+// сканера event, с проверкой допустимости перехода, как в SetStatusValidated
+func (s ParcelService) RecordScanEvent(number int, event string) error {
+	status, ok := scanEventStatuses[event]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEvent, event)
+	}
+
+	return s.SetStatusValidated(number, status)
+}
+
+// nextParcelStatus возвращает статус, следующий за status;
+// ok равен false, если перейти дальше нельзя
+func nextParcelStatus(status string) (next string, ok bool) {
+	switch status {
+	case ParcelStatusRegistered, ParcelStatusProcessing:
+		return ParcelStatusSent, true
+	case ParcelStatusSent:
+		return ParcelStatusDelivered, true
+	}
+
+	return "", false
+}
+
+// StatusDistribution возвращает долю посылок клиента в каждом статусе;
+// сумма долей равна 1, для клиента без посылок возвращается пустой map
+func (s ParcelService) StatusDistribution(client int) (map[string]float64, error) {
+	parcels, err := s.store.GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]float64{}
+	for _, parcel := range parcels {
+		res[parcel.Status]++
+	}
+	for status := range res {
+		res[status] /= float64(len(parcels))
+	}
 
-	return s.store.SetStatus(number, nextStatus)
+	return res, nil
+}
+
+// CompletionRate возвращает долю доставленных посылок клиента
+// среди всех его посылок, для клиента без посылок - 0
+func (s ParcelService) CompletionRate(client int) (float64, error) {
+	distribution, err := s.StatusDistribution(client)
+	if err != nil {
+		return 0, err
+	}
+
+	return distribution[ParcelStatusDelivered], nil
+}
+
+// Requeue возвращает посылку со статусом failed в статус registered
+// для повторной доставки и обнуляет счётчик попыток.
+// Для посылок в других статусах возвращается ErrInvalidTransition
+func (s ParcelService) Requeue(number int) error {
+	unlock, err := s.lockParcelClient(number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var parcel Parcel
+	err = s.store.WithTx(func(tx ParcelStore) error {
+		status, err := tx.GetStatus(number)
+		if err != nil {
+			return err
+		}
+		if status != ParcelStatusFailed {
+			return ErrInvalidTransition
+		}
+
+		if err := tx.SetStatus(number, ParcelStatusRegistered); err != nil {
+			return err
+		}
+		if err := tx.ResetAttempts(number); err != nil {
+			return err
+		}
+
+		parcel, err = tx.Get(number)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publish(ParcelEvent{Type: EventStatusChanged, Parcel: parcel})
+
+	return nil
 }
 
 func (s ParcelService) ChangeAddress(number int, address string) error {
-	return s.store.SetAddress(number, address)
+	address, err := s.prepareAddress(address)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lockParcelClient(number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.store.SetAddress(number, address); err != nil {
+		return err
+	}
+	if s.mirror != nil {
+		s.mirror.mirrorPut(number)
+	}
+
+	return nil
+}
+
+// Correct в одной транзакции передаёт посылку клиенту newClient и меняет
+// её адрес на newAddress. Если адрес поменять нельзя, передача тоже отменяется
+func (s ParcelService) Correct(number, newClient int, newAddress string) error {
+	newAddress, err := s.prepareAddress(newAddress)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lockParcelClient(number, newClient)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = s.store.WithTx(func(tx ParcelStore) error {
+		if err := tx.SetClient(number, newClient); err != nil {
+			return err
+		}
+
+		status, err := tx.GetStatus(number)
+		if err != nil {
+			return err
+		}
+		if status != ParcelStatusRegistered {
+			return ErrNotRegistered
+		}
+
+		return tx.SetAddress(number, newAddress)
+	})
+	if err != nil {
+		return err
+	}
+	if s.mirror != nil {
+		s.mirror.mirrorPut(number)
+	}
+
+	return nil
 }
 
 func (s ParcelService) Delete(number int) error {
-	return s.store.Delete(number)
+	unlock, err := s.lockParcelClient(number)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	parcel, err := s.store.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		// удалять нечего
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(number); err != nil {
+		return err
+	}
+
+	// store.Delete не трогает посылки не в статусе registered
+	if parcel.Status == ParcelStatusRegistered {
+		s.publish(ParcelEvent{Type: EventDeleted, Parcel: parcel})
+	}
+
+	return nil
 }
 
 func main() {
-	// настройте подключение к БД
+	cfg := Config{DSN: "tracker.db", MaxConcurrentExports: 4}
+
+	// настраиваем подключение к БД
+	db, err := sql.Open("sqlite", withBusyTimeout(cfg.DSN))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	err = Migrate(db)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	store := // создайте объект ParcelStore функцией NewParcelStore
-	service := NewParcelService(store)
+	store := NewParcelStore(db).WithQueryTimeout(cfg.QueryTimeout)
+	service := NewParcelService(store, WithConfig(cfg))
 
 	// регистрация посылки
 	client := 1
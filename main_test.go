@@ -0,0 +1,530 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetStatusValidated проверяет перевод посылки в запрошенный статус
+func TestSetStatusValidated(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// valid next
+	err = service.SetStatusValidated(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	// illegal jump
+	id, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	err = service.SetStatusValidated(id, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// unknown target status
+	err = service.SetStatusValidated(id, "lost")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+}
+
+// TestNextStatusCooldown проверяет, что частая смена статуса подавляется
+func TestNextStatusCooldown(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	cooldown := 100 * time.Millisecond
+	service := NewParcelService(store, WithStatusCooldown(cooldown))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// first advance
+	err = service.NextStatus(id)
+	require.NoError(t, err)
+
+	// second advance right away
+	err = service.NextStatus(id)
+	require.ErrorIs(t, err, ErrTooSoon)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	// advance after cooldown
+	time.Sleep(cooldown)
+
+	err = service.NextStatus(id)
+	require.NoError(t, err)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusDelivered, stored.Status)
+}
+
+// TestNextStatusCooldownFailedWrite проверяет, что неудачная смена статуса
+// не запрещает повторную попытку
+func TestNextStatusCooldownFailedWrite(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store, WithStatusCooldown(time.Hour))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	_, err = db.Exec(`CREATE TRIGGER parcel_readonly BEFORE UPDATE ON parcel
+BEGIN SELECT RAISE(ABORT, 'parcel is read-only'); END`)
+	require.NoError(t, err)
+
+	// failed advance
+	err = service.NextStatus(id)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrTooSoon)
+
+	// retry
+	_, err = db.Exec("DROP TRIGGER parcel_readonly")
+	require.NoError(t, err)
+
+	err = service.NextStatus(id)
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+}
+
+// TestStatusDistribution проверяет расчёт долей статусов посылок клиента
+func TestStatusDistribution(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	client := randRange.Intn(10_000_000)
+	statuses := []string{
+		ParcelStatusRegistered,
+		ParcelStatusSent, ParcelStatusSent,
+		ParcelStatusDelivered,
+	}
+
+	// empty
+	distribution, err := service.StatusDistribution(client)
+	require.NoError(t, err)
+	require.Empty(t, distribution)
+
+	// add
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	distribution, err = service.StatusDistribution(client)
+	require.NoError(t, err)
+	require.Len(t, distribution, 3)
+	require.InDelta(t, 0.25, distribution[ParcelStatusRegistered], 1e-9)
+	require.InDelta(t, 0.5, distribution[ParcelStatusSent], 1e-9)
+	require.InDelta(t, 0.25, distribution[ParcelStatusDelivered], 1e-9)
+}
+
+// TestCompletionRate проверяет долю доставленных посылок клиента
+func TestCompletionRate(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	client := randRange.Intn(10_000_000)
+	statuses := []string{
+		ParcelStatusRegistered,
+		ParcelStatusSent,
+		ParcelStatusFailed,
+		ParcelStatusDelivered, ParcelStatusDelivered, ParcelStatusDelivered,
+		ParcelStatusDelivered, ParcelStatusDelivered,
+	}
+
+	// empty
+	rate, err := service.CompletionRate(client)
+	require.NoError(t, err)
+	require.Zero(t, rate)
+
+	// add
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	rate, err = service.CompletionRate(client)
+	require.NoError(t, err)
+	require.InDelta(t, 5.0/8, rate, 1e-9)
+}
+
+// TestRegisterNormalizesAddress проверяет очистку адреса при регистрации посылки
+func TestRegisterNormalizesAddress(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	// register
+	parcel, err := service.Register(1000, "Псков,\nул. Колотушкина,\tд. 5")
+	require.NoError(t, err)
+
+	_, err = service.Register(1000, "Псков\x1b[31m")
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	// check
+	stored, err := store.Get(parcel.Number)
+	require.NoError(t, err)
+	require.Equal(t, "Псков, ул. Колотушкина, д. 5", stored.Address)
+}
+
+// TestCorrect проверяет совместную смену клиента и адреса посылки
+func TestCorrect(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	parcel := getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// correct registered parcel
+	err = service.Correct(id, parcel.Client+1, "new test address")
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, parcel.Client+1, stored.Client)
+	require.Equal(t, "new test address", stored.Address)
+
+	// correct sent parcel, адрес поменять нельзя
+	sent := getTestParcel()
+	sent.Status = ParcelStatusSent
+	sentID, err := store.Add(sent)
+	require.NoError(t, err)
+
+	err = service.Correct(sentID, sent.Client+1, "new test address")
+	require.ErrorIs(t, err, ErrNotRegistered)
+
+	// check, смена клиента откатилась вместе с адресом
+	stored, err = store.Get(sentID)
+	require.NoError(t, err)
+	require.Equal(t, sent.Client, stored.Client)
+	require.Equal(t, sent.Address, stored.Address)
+}
+
+// TestParseStatus проверяет разбор статуса без учёта регистра
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      error
+	}{
+		{input: "registered", expected: ParcelStatusRegistered},
+		{input: "Sent", expected: ParcelStatusSent},
+		{input: "SENT", expected: ParcelStatusSent},
+		{input: " DeLiVeReD ", expected: ParcelStatusDelivered},
+		{input: "lost", err: ErrUnknownStatus},
+		{input: "", err: ErrUnknownStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			status, err := ParseStatus(tt.input)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.expected, status)
+		})
+	}
+}
+
+// TestSetStatusValidatedMixedCase проверяет перевод в статус, переданный в другом регистре
+func TestSetStatusValidatedMixedCase(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	require.NoError(t, service.SetStatusValidated(id, "SENT"))
+
+	err = service.SetStatusValidated(id, "Lost")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+	require.ErrorIs(t, err, ErrUnknownStatus)
+
+	// check, в БД статус хранится в нижнем регистре
+	status, err := store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+}
+
+// TestRequeue проверяет возврат неудачно доставленной посылки в очередь
+func TestRequeue(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.MarkFailed(id))
+	require.NoError(t, store.MarkFailed(id))
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusFailed, stored.Status)
+	require.Equal(t, 2, stored.Attempts)
+
+	// requeue failed parcel
+	require.NoError(t, service.Requeue(id))
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Zero(t, stored.Attempts)
+
+	// requeue sent parcel
+	sent := getTestParcel()
+	sent.Status = ParcelStatusSent
+	sentID, err := store.Add(sent)
+	require.NoError(t, err)
+
+	err = service.Requeue(sentID)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	status, err := store.GetStatus(sentID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+}
+
+// TestRecordScanEvent проверяет смену статуса по событиям сканера
+func TestRecordScanEvent(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// delivered before dispatched
+	err = service.RecordScanEvent(id, "delivered")
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// dispatched
+	require.NoError(t, service.RecordScanEvent(id, "dispatched"))
+	status, err := store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	// delivered
+	require.NoError(t, service.RecordScanEvent(id, "delivered"))
+	status, err = store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusDelivered, status)
+
+	// unknown event
+	err = service.RecordScanEvent(id, "scanned at hub")
+	require.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+// TestRegisterBatchDedup проверяет пропуск адресов, на которые у клиента
+// уже есть зарегистрированная посылка
+func TestRegisterBatchDedup(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	client := 1000
+	_, err := service.Register(client, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+
+	// посылка на этот адрес уже отправлена и дубликатом не считается
+	sent, err := service.Register(client, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent.Number, ParcelStatusSent))
+
+	// у другого клиента та же посылка не мешает регистрации
+	_, err = service.Register(client+1, "Тверь, ул. Советская, д. 3")
+	require.NoError(t, err)
+
+	// register
+	created, skipped, err := service.RegisterBatchDedup(client, []string{
+		"Псков, ул. Колотушкина, д. 5",
+		"Москва, ул. Тверская, д. 1",
+		"Тверь, ул. Советская, д. 3",
+		"Тверь,\tул. Советская, д. 3",
+	})
+	require.NoError(t, err)
+
+	// check
+	var addresses []string
+	for _, p := range created {
+		require.NotZero(t, p.Number)
+		require.Equal(t, ParcelStatusRegistered, p.Status)
+		addresses = append(addresses, p.Address)
+	}
+	require.Equal(t, []string{"Москва, ул. Тверская, д. 1", "Тверь, ул. Советская, д. 3"}, addresses)
+	require.Equal(t, []string{"Псков, ул. Колотушкина, д. 5", "Тверь, ул. Советская, д. 3"}, skipped)
+
+	count, err := store.CountByClient(client)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	// некорректный адрес отменяет всю регистрацию
+	_, _, err = service.RegisterBatchDedup(client, []string{"Тула, ул. Ленина, д. 1", "\x00"})
+	require.ErrorIs(t, err, ErrInvalidAddress)
+
+	count, err = store.CountByClient(client)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
+
+// TestNextStatusMissingAddress проверяет, что посылку без адреса нельзя отправить
+func TestNextStatusMissingAddress(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	withAddress, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	parcel := getTestParcel()
+	parcel.Address = ""
+	withoutAddress, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// check
+	require.NoError(t, service.NextStatus(withAddress))
+
+	stored, err := store.Get(withAddress)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	err = service.NextStatus(withoutAddress)
+	require.ErrorIs(t, err, ErrMissingAddress)
+
+	err = service.SetStatusValidated(withoutAddress, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrMissingAddress)
+
+	stored, err = store.Get(withoutAddress)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+}
+
+// TestRegisterInRange проверяет регистрацию с номером из выделенного диапазона
+func TestRegisterInRange(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	// in range
+	p, err := service.RegisterInRange(1000, "Псков, ул. Колотушкина, д. 5", 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, p.Number)
+
+	_, err = service.Register(1000, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+
+	// следующий номер 3 уже не входит в диапазон
+	_, err = service.RegisterInRange(1000, "Тверь, ул. Советская, д. 3", 1, 2)
+	require.ErrorIs(t, err, ErrNumberOutOfRange)
+
+	_, err = service.RegisterInRange(1000, "Тверь, ул. Советская, д. 3", 5, 1)
+	require.ErrorIs(t, err, ErrInvalidRange)
+
+	// check
+	count, err := store.CountByClient(1000)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// отменённая регистрация не расходует номер
+	p, err = service.RegisterInRange(1000, "Тверь, ул. Советская, д. 3", 3, 10)
+	require.NoError(t, err)
+	require.Equal(t, 3, p.Number)
+}
+
+// TestSetStatusBatchAtomic проверяет, что недопустимый переход отменяет
+// все изменения пакета
+func TestSetStatusBatchAtomic(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+
+	// illegal: registered -> delivered
+	err := service.SetStatusBatchAtomic(map[int]string{
+		numbers[0]: ParcelStatusSent,
+		numbers[1]: ParcelStatusDelivered,
+		numbers[2]: ParcelStatusDelivered,
+	})
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	// check
+	statuses, err := store.GetStatuses(numbers)
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{
+		numbers[0]: ParcelStatusRegistered,
+		numbers[1]: ParcelStatusSent,
+		numbers[2]: ParcelStatusRegistered,
+	}, statuses)
+
+	// valid
+	err = service.SetStatusBatchAtomic(map[int]string{
+		numbers[0]: ParcelStatusSent,
+		numbers[1]: ParcelStatusDelivered,
+		numbers[2]: ParcelStatusSent,
+	})
+	require.NoError(t, err)
+
+	statuses, err = store.GetStatuses(numbers)
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{
+		numbers[0]: ParcelStatusSent,
+		numbers[1]: ParcelStatusDelivered,
+		numbers[2]: ParcelStatusSent,
+	}, statuses)
+
+	err = service.SetStatusBatchAtomic(map[int]string{numbers[2] + 1: ParcelStatusSent})
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidMetadata возвращается, когда метаданные нельзя сохранить как JSON
+var ErrInvalidMetadata = errors.New("некорректные метаданные посылки")
+
+// SetMetadata сохраняет произвольные метаданные посылки в виде JSON.
+// Значения, которые нельзя представить в JSON, отклоняются с ErrInvalidMetadata
+func (s ParcelStore) SetMetadata(number int, m map[string]interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+
+	res, err := s.q.Exec("UPDATE parcel SET metadata = :metadata, version = version + 1 WHERE number = :number",
+		sql.Named("metadata", string(data)),
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// GetMetadata возвращает метаданные посылки. Если метаданные
+// не задавались, возвращается пустая карта
+func (s ParcelStore) GetMetadata(number int) (map[string]interface{}, error) {
+	var data sql.NullString
+	err := s.q.QueryRow("SELECT metadata FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrParcelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	if !data.Valid || data.String == "" {
+		return m, nil
+	}
+	if err := json.Unmarshal([]byte(data.String), &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// FindByMetadata возвращает посылки, у которых в метаданных ключ key
+// верхнего уровня равен строке value. Посылки без метаданных не попадают
+// в результат
+func (s ParcelStore) FindByMetadata(key, value string) ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE metadata IS NOT NULL AND json_extract(metadata, :path) = :value ORDER BY number ASC",
+		sql.Named("path", "$."+strconv.Quote(key)),
+		sql.Named("value", value))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetadataRoundTrip проверяет сохранение и чтение вложенных метаданных
+func TestMetadataRoundTrip(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	number, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// без метаданных возвращается пустая карта
+	m, err := store.GetMetadata(number)
+	require.NoError(t, err)
+	require.Empty(t, m)
+
+	// set
+	metadata := map[string]interface{}{
+		"source": "marketplace",
+		"order": map[string]interface{}{
+			"id":    "A-17",
+			"items": []interface{}{"book", "pen"},
+			"paid":  true,
+		},
+		"weight": 1.5,
+	}
+	err = store.SetMetadata(number, metadata)
+	require.NoError(t, err)
+
+	// check
+	m, err = store.GetMetadata(number)
+	require.NoError(t, err)
+	require.Equal(t, metadata, m)
+
+	// значения, которые нельзя представить в JSON, отклоняются
+	err = store.SetMetadata(number, map[string]interface{}{"callback": func() {}})
+	require.ErrorIs(t, err, ErrInvalidMetadata)
+
+	_, err = store.GetMetadata(number + 100)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestFindByMetadata проверяет поиск посылок по значению ключа метаданных
+func TestFindByMetadata(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	numbers := make([]int, 4)
+	for i := range numbers {
+		number, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers[i] = number
+	}
+
+	require.NoError(t, store.SetMetadata(numbers[0], map[string]interface{}{"source": "marketplace"}))
+	require.NoError(t, store.SetMetadata(numbers[1], map[string]interface{}{"source": "office"}))
+	require.NoError(t, store.SetMetadata(numbers[2], map[string]interface{}{"source": "marketplace", "order.id": "A-17"}))
+	// у numbers[3] метаданных нет
+
+	// check
+	found, err := store.FindByMetadata("source", "marketplace")
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[0], found[0].Number)
+	require.Equal(t, numbers[2], found[1].Number)
+
+	// точка в ключе не считается вложенностью
+	found, err = store.FindByMetadata("order.id", "A-17")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, numbers[2], found[0].Number)
+
+	found, err = store.FindByMetadata("source", "courier")
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
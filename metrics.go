@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// WritePrometheusMetrics записывает в w метрики посылок в текстовом формате
+// Prometheus: общее количество посылок и количество в каждом статусе.
+// Все значения читаются из одного снимка БД
+func (s ParcelStore) WritePrometheusMetrics(w io.Writer) error {
+	var total int
+	byStatus := make([]int, len(parcelStatuses))
+	err := s.ReadTx(func(tx ParcelStore) error {
+		var err error
+		total, err = tx.Total()
+		if err != nil {
+			return err
+		}
+
+		for i, status := range parcelStatuses {
+			byStatus[i], err = tx.CountByStatus(status)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "# HELP parcels_total Количество посылок.\n# TYPE parcels_total gauge\nparcels_total %d\n", total)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(w, "# HELP parcels_by_status Количество посылок в каждом статусе.\n# TYPE parcels_by_status gauge\n")
+	if err != nil {
+		return err
+	}
+	for i, status := range parcelStatuses {
+		if _, err := fmt.Fprintf(w, "parcels_by_status{status=%q} %d\n", status, byStatus[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
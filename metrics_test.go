@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestWritePrometheusMetrics проверяет значения метрик в выводе
+func TestWritePrometheusMetrics(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	statuses := []string{
+		ParcelStatusRegistered, ParcelStatusRegistered, ParcelStatusRegistered,
+		ParcelStatusSent, ParcelStatusSent,
+		ParcelStatusDelivered,
+	}
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// write
+	var buf bytes.Buffer
+	require.NoError(t, store.WritePrometheusMetrics(&buf))
+
+	// check
+	out := buf.String()
+	require.Contains(t, out, "# TYPE parcels_total gauge\n")
+	require.Contains(t, out, "\nparcels_total 6\n")
+	require.Contains(t, out, "# TYPE parcels_by_status gauge\n")
+	require.Contains(t, out, "\nparcels_by_status{status=\"registered\"} 3\n")
+	require.Contains(t, out, "\nparcels_by_status{status=\"sent\"} 2\n")
+	require.Contains(t, out, "\nparcels_by_status{status=\"delivered\"} 1\n")
+	require.Contains(t, out, "\nparcels_by_status{status=\"failed\"} 0\n")
+	require.Contains(t, out, "\nparcels_by_status{status=\"processing\"} 0\n")
+}
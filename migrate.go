@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration шаг миграции схемы БД
+type migration struct {
+	version int
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations шаги миграции в порядке применения. Версии идут подряд
+// начиная с 1, новые шаги добавляются только в конец
+var migrations = []migration{
+	// базовая схема: таблицы и столбцы, созданные до появления версий
+	{version: 1, apply: schemaV1},
+	// журнал изменений посылок
+	{version: 2, apply: createChangelog},
+	// время смены статуса у посылок, созданных до появления столбца
+	{version: 3, apply: backfillStatusChangedAt},
+}
+
+// Migrate применяет к БД ещё не применённые шаги миграции по порядку
+// и записывает в schema_version версию каждого из них. Каждый шаг
+// выполняется в одной транзакции с записью своей версии, так что
+// прерванный шаг не остаётся применённым наполовину.
+// Повторный вызов ничего не меняет
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    applied_at VARCHAR(256) NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("миграция %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration в одной транзакции применяет шаг m, если он ещё
+// не применён, и записывает его версию в schema_version
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		return err
+	}
+	if m.version <= current {
+		return nil
+	}
+
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version (version) VALUES (:version)",
+		sql.Named("version", m.version))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion возвращает версию последнего применённого шага миграции,
+// 0 - если миграции ещё не применялись
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrate проверяет применение миграций к новой БД и повторный запуск
+func TestMigrate(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// migrate
+	require.NoError(t, Migrate(db))
+
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.Equal(t, migrations[len(migrations)-1].version, version)
+
+	store := NewParcelStore(db)
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// повторный запуск ничего не меняет
+	require.NoError(t, Migrate(db))
+
+	again, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.Equal(t, version, again)
+
+	var applied int
+	err = db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&applied)
+	require.NoError(t, err)
+	require.Equal(t, len(migrations), applied)
+
+	_, err = store.Get(id)
+	require.NoError(t, err)
+}
+
+// TestMigrateLegacyStatusChangedAt проверяет, что посылкам из таблицы первой
+// версии время смены статуса заполняется временем создания
+func TestMigrateLegacyStatusChangedAt(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE parcel (
+    number INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    address VARCHAR(256) NOT NULL,
+    created_at VARCHAR(256) NOT NULL
+)`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (1000, :status, 'test', '2024-03-01T12:00:00Z')",
+		sql.Named("status", ParcelStatusSent))
+	require.NoError(t, err)
+
+	// migrate
+	require.NoError(t, Migrate(db))
+
+	// check
+	store := NewParcelStore(db)
+	stuck, err := store.StuckInSent(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Empty(t, stuck)
+
+	stuck, err = store.StuckInSent(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+}
+
+// TestMigrateFailedStep проверяет, что шаг, завершившийся ошибкой,
+// не оставляет ни своих изменений, ни записи о версии
+func TestMigrateFailedStep(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, Migrate(db))
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	errStep := errors.New("шаг не выполнен")
+	last := saved[len(saved)-1].version
+	migrations = append(append([]migration(nil), saved...), migration{
+		version: last + 1,
+		apply: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errStep
+		},
+	})
+
+	// migrate
+	err = Migrate(db)
+	require.ErrorIs(t, err, errStep)
+
+	// check
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	require.Equal(t, last, version)
+
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'").Scan(&tables))
+	require.Zero(t, tables)
+}
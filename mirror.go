@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ParcelStorer основные операции хранилища посылок.
+// Его реализуют ParcelStore и MirrorStore
+type ParcelStorer interface {
+	Add(p Parcel) (int, error)
+	Put(p Parcel) error
+	Get(number int) (Parcel, error)
+	GetByClient(client int) ([]Parcel, error)
+	SetStatus(number int, status string) error
+	SetAddress(number int, address string) error
+	SetClient(number int, client int) error
+	Delete(number int) error
+}
+
+// Put сохраняет посылку p под номером p.Number: добавляет её, если такой
+// посылки нет, или заменяет все поля существующей. Время смены статуса
+// и доставки обновляется, только если статус изменился
+func (s ParcelStore) Put(p Parcel) error {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+
+	return s.inTx(nil, func(tx ParcelStore) error {
+		_, err := tx.q.Exec(`INSERT INTO parcel (number, client, status, address, created_at, status_changed_at, priority, attempts, version, delivered_at,
+    weight_grams, length_mm, width_mm, height_mm, claimed_by, claimed_at)
+VALUES (:number, :client, :status, :address, :created_at, :created_at, :priority, :attempts, :version, CASE WHEN :status = :delivered THEN :created_at ELSE '' END,
+    :weight_grams, :length_mm, :width_mm, :height_mm, :claimed_by, :claimed_at)
+ON CONFLICT (number) DO UPDATE SET
+    status_changed_at = CASE WHEN status = excluded.status THEN status_changed_at ELSE :changed_at END,
+    delivered_at = CASE WHEN status = excluded.status THEN delivered_at WHEN excluded.status = :delivered THEN :changed_at ELSE delivered_at END,
+    client = excluded.client, status = excluded.status, address = excluded.address, created_at = excluded.created_at,
+    priority = excluded.priority, attempts = excluded.attempts, version = excluded.version,
+    weight_grams = excluded.weight_grams, length_mm = excluded.length_mm, width_mm = excluded.width_mm, height_mm = excluded.height_mm,
+    claimed_by = excluded.claimed_by, claimed_at = excluded.claimed_at`,
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", p.Number),
+			sql.Named("client", p.Client),
+			sql.Named("status", p.Status),
+			sql.Named("address", p.Address),
+			sql.Named("created_at", p.CreatedAt),
+			sql.Named("priority", p.Priority),
+			sql.Named("attempts", p.Attempts),
+			sql.Named("version", p.Version),
+			sql.Named("weight_grams", p.WeightGrams),
+			sql.Named("length_mm", p.LengthMM),
+			sql.Named("width_mm", p.WidthMM),
+			sql.Named("height_mm", p.HeightMM),
+			sql.Named("claimed_by", p.ClaimedBy),
+			sql.Named("claimed_at", p.ClaimedAt))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChange(p.Number, ChangePut); err != nil {
+			return err
+		}
+
+		return tx.addHistory(p.Number, p.Status, changedAt)
+	})
+}
+
+// MirrorStore хранилище, дублирующее все изменения в резервное хранилище.
+// Изменение сначала выполняется в основном хранилище, и только если оно
+// прошло успешно - в резервном. Ошибки резервного хранилища не возвращаются,
+// а пишутся в лог. Чтение идёт только из основного хранилища.
+//
+// Копия посылки сохраняется в резервном хранилище через Put под тем же
+// номером, что и в основном, и после каждого изменения перезаписывается
+// целиком. Поэтому номера в хранилищах не расходятся даже после
+// перезапуска, а копия, которую не удалось сохранить, восстанавливается
+// при следующем изменении посылки.
+//
+// ParcelService дублирует свои изменения так же, если создан с WithMirror
+type MirrorStore struct {
+	primary   ParcelStorer
+	secondary ParcelStorer
+	logger    Logger
+}
+
+func NewMirrorStore(primary, secondary ParcelStorer, logger Logger) MirrorStore {
+	if logger == nil {
+		logger = stdoutLogger{}
+	}
+
+	return MirrorStore{
+		primary:   primary,
+		secondary: secondary,
+		logger:    logger,
+	}
+}
+
+func (m MirrorStore) Add(p Parcel) (int, error) {
+	id, err := m.primary.Add(p)
+	if err != nil {
+		return 0, err
+	}
+	m.mirrorPut(id)
+
+	return id, nil
+}
+
+func (m MirrorStore) Put(p Parcel) error {
+	if err := m.primary.Put(p); err != nil {
+		return err
+	}
+	m.mirrorPut(p.Number)
+
+	return nil
+}
+
+func (m MirrorStore) Get(number int) (Parcel, error) {
+	return m.primary.Get(number)
+}
+
+func (m MirrorStore) GetByClient(client int) ([]Parcel, error) {
+	return m.primary.GetByClient(client)
+}
+
+func (m MirrorStore) SetStatus(number int, status string) error {
+	if err := m.primary.SetStatus(number, status); err != nil {
+		return err
+	}
+	m.mirrorPut(number)
+
+	return nil
+}
+
+func (m MirrorStore) SetAddress(number int, address string) error {
+	if err := m.primary.SetAddress(number, address); err != nil {
+		return err
+	}
+	m.mirrorPut(number)
+
+	return nil
+}
+
+func (m MirrorStore) SetClient(number int, client int) error {
+	if err := m.primary.SetClient(number, client); err != nil {
+		return err
+	}
+	m.mirrorPut(number)
+
+	return nil
+}
+
+func (m MirrorStore) Delete(number int) error {
+	if err := m.primary.Delete(number); err != nil {
+		return err
+	}
+	m.mirrorDelete(number)
+
+	return nil
+}
+
+// mirrorPut перезаписывает копию посылки number в резервном хранилище
+// её текущим состоянием в основном
+func (m MirrorStore) mirrorPut(number int) {
+	p, err := m.primary.Get(number)
+	if err != nil {
+		m.logger.Printf("Резервное хранилище: не удалось прочитать посылку № %d: %v\n", number, err)
+		return
+	}
+
+	if err := m.secondary.Put(p); err != nil {
+		m.logger.Printf("Резервное хранилище: не удалось сохранить посылку № %d: %v\n", number, err)
+	}
+}
+
+func (m MirrorStore) mirrorDelete(number int) {
+	if err := m.secondary.Delete(number); err != nil {
+		m.logger.Printf("Резервное хранилище: не удалось удалить посылку № %d: %v\n", number, err)
+	}
+}
+
+// mirrorEvent передаёт в резервное хранилище изменение, уже выполненное
+// сервисом в основном хранилище и описанное событием e
+func (m MirrorStore) mirrorEvent(e ParcelEvent) {
+	switch e.Type {
+	case EventRegistered, EventStatusChanged:
+		m.mirrorPut(e.Parcel.Number)
+	case EventDeleted:
+		m.mirrorDelete(e.Parcel.Number)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// errSecondaryDown возвращается brokenStore на любое изменение
+var errSecondaryDown = errors.New("резервное хранилище недоступно")
+
+// brokenStore хранилище, в котором не проходит ни одно изменение
+type brokenStore struct {
+	ParcelStore
+}
+
+func (brokenStore) Put(Parcel) error {
+	return errSecondaryDown
+}
+
+func (brokenStore) Delete(int) error {
+	return errSecondaryDown
+}
+
+// flakyStore хранилище, изменения в котором не проходят, пока down равен true
+type flakyStore struct {
+	ParcelStore
+	down *bool
+}
+
+func (s flakyStore) Put(p Parcel) error {
+	if *s.down {
+		return errSecondaryDown
+	}
+
+	return s.ParcelStore.Put(p)
+}
+
+// TestMirrorStore проверяет, что изменения доходят до обоих хранилищ
+func TestMirrorStore(t *testing.T) {
+	// prepare
+	primary := NewParcelStore(setupDB(t))
+	secondary := NewParcelStore(setupDB(t))
+	logger := &recordingLogger{}
+	store := NewMirrorStore(primary, secondary, logger)
+
+	// add
+	parcel := getTestParcel()
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetAddress(id, "Псков, ул. Колотушкина, д. 5"))
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	// check
+	for _, s := range []ParcelStore{primary, secondary} {
+		stored, err := s.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, "Псков, ул. Колотушкина, д. 5", stored.Address)
+		require.Equal(t, ParcelStatusSent, stored.Status)
+	}
+
+	// delete
+	id, err = store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(id))
+
+	for _, s := range []ParcelStore{primary, secondary} {
+		_, err := s.Get(id)
+		require.Error(t, err)
+	}
+	require.Empty(t, logger.lines)
+}
+
+// TestMirrorStoreSecondaryFailure проверяет, что ошибка резервного
+// хранилища не мешает изменению основного
+func TestMirrorStoreSecondaryFailure(t *testing.T) {
+	// prepare
+	primary := NewParcelStore(setupDB(t))
+	logger := &recordingLogger{}
+	store := NewMirrorStore(primary, brokenStore{}, logger)
+
+	// check
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetAddress(id, "Псков, ул. Колотушкина, д. 5"))
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "Псков, ул. Колотушкина, д. 5", stored.Address)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	// копия не добавлена, поэтому следующие изменения в резервное
+	// хранилище не передаются
+	require.Len(t, logger.lines, 3)
+	for _, line := range logger.lines {
+		require.Contains(t, line, errSecondaryDown.Error())
+	}
+}
+
+// TestMirrorStoreSameNumbers проверяет, что копия посылки получает номер
+// посылки в основном хранилище, и изменения после перезапуска доходят
+// до неё, а не до другой посылки резервного хранилища
+func TestMirrorStoreSameNumbers(t *testing.T) {
+	// prepare
+	primary := NewParcelStore(setupDB(t))
+	secondary := NewParcelStore(setupDB(t))
+	logger := &recordingLogger{}
+
+	// в резервном хранилище уже есть посылки
+	for i := 0; i < 2; i++ {
+		_, err := secondary.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+	_, err := primary.Add(getTestParcel())
+	require.NoError(t, err)
+
+	store := NewMirrorStore(primary, secondary, logger)
+	parcel := getTestParcel()
+	parcel.Address = "Псков, ул. Колотушкина, д. 5"
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// перезапуск
+	store = NewMirrorStore(primary, secondary, logger)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	// check
+	stored, err := primary.Get(id)
+	require.NoError(t, err)
+	copied, err := secondary.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, stored, copied)
+
+	other, err := secondary.Get(id - 1)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, other.Status)
+	require.Equal(t, getTestParcel().Address, other.Address)
+	require.Empty(t, logger.lines)
+}
+
+// TestMirrorStoreRecovers проверяет, что копия, которую не удалось
+// сохранить, восстанавливается при следующем изменении посылки
+func TestMirrorStoreRecovers(t *testing.T) {
+	// prepare
+	primary := NewParcelStore(setupDB(t))
+	secondary := NewParcelStore(setupDB(t))
+	logger := &recordingLogger{}
+	down := true
+	store := NewMirrorStore(primary, flakyStore{ParcelStore: secondary, down: &down}, logger)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Len(t, logger.lines, 1)
+
+	// check
+	down = false
+	require.NoError(t, store.SetAddress(id, "Псков, ул. Колотушкина, д. 5"))
+
+	stored, err := primary.Get(id)
+	require.NoError(t, err)
+	copied, err := secondary.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, stored, copied)
+	require.Len(t, logger.lines, 1)
+}
+
+// TestServiceWithMirror проверяет, что изменения, выполненные через сервис,
+// доходят до резервного хранилища
+func TestServiceWithMirror(t *testing.T) {
+	// prepare
+	primary := NewParcelStore(setupDB(t))
+	secondary := NewParcelStore(setupDB(t))
+	logger := &recordingLogger{}
+	service := NewParcelService(primary, WithLogger(logger), WithMirror(secondary))
+
+	// check
+	p, err := service.Register(1000, "Псков, ул. Сиреневая, д. 3")
+	require.NoError(t, err)
+	require.NoError(t, service.ChangeAddress(p.Number, "Псков, ул. Колотушкина, д. 5"))
+	require.NoError(t, service.NextStatus(p.Number))
+
+	stored, err := secondary.Get(p.Number)
+	require.NoError(t, err)
+	require.Equal(t, "Псков, ул. Колотушкина, д. 5", stored.Address)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+
+	// Requeue сбрасывает счётчик попыток и в копии
+	p, err = service.Register(1000, "Псков, ул. Сиреневая, д. 3")
+	require.NoError(t, err)
+	require.NoError(t, secondary.MarkFailed(p.Number))
+	require.NoError(t, primary.MarkFailed(p.Number))
+	require.NoError(t, service.Requeue(p.Number))
+
+	stored, err = secondary.Get(p.Number)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+	require.Zero(t, stored.Attempts)
+
+	require.NoError(t, service.Delete(p.Number))
+
+	_, err = secondary.Get(p.Number)
+	require.Error(t, err)
+	for _, line := range logger.lines {
+		require.NotContains(t, line, "Резервное хранилище")
+	}
+}
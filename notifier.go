@@ -0,0 +1,6 @@
+package main
+
+// DeliveryNotifier получает уведомление о каждой доставленной посылке
+type DeliveryNotifier interface {
+	NotifyDelivered(p Parcel) error
+}
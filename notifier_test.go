@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier запоминает посылки, о доставке которых его уведомили
+type recordingNotifier struct {
+	delivered []Parcel
+	err       error
+}
+
+func (n *recordingNotifier) NotifyDelivered(p Parcel) error {
+	n.delivered = append(n.delivered, p)
+	return n.err
+}
+
+// TestDeliveryNotifier проверяет, что уведомление отправляется ровно один раз при доставке
+func TestDeliveryNotifier(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	// ошибка уведомления не должна мешать смене статуса
+	notifier := &recordingNotifier{err: errors.New("notification failed")}
+	service := NewParcelService(store, WithNotifier(notifier))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// registered -> sent
+	require.NoError(t, service.NextStatus(id))
+	require.Empty(t, notifier.delivered)
+
+	// sent -> delivered
+	require.NoError(t, service.NextStatus(id))
+
+	// delivered, дальше статус не меняется
+	require.NoError(t, service.NextStatus(id))
+
+	// check
+	require.Len(t, notifier.delivered, 1)
+	require.Equal(t, id, notifier.delivered[0].Number)
+	require.Equal(t, ParcelStatusDelivered, notifier.delivered[0].Status)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Logger принимает сообщения сервиса о регистрации посылок и смене статусов
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// stdoutLogger логгер по умолчанию, печатает сообщения в stdout
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// Clock источник текущего времени для сервиса
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock часы по умолчанию, возвращают системное время
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// ServiceOption настраивает ParcelService при создании в NewParcelService
+type ServiceOption func(*ParcelService)
+
+// WithLogger задаёт логгер сервиса вместо вывода в stdout
+func WithLogger(l Logger) ServiceOption {
+	return func(s *ParcelService) {
+		s.logger = l
+	}
+}
+
+// WithNotifier задаёт получателя уведомлений о доставленных посылках
+func WithNotifier(n DeliveryNotifier) ServiceOption {
+	return func(s *ParcelService) {
+		s.notifier = n
+	}
+}
+
+// WithStatusModel задаёт модель переходов между статусами
+func WithStatusModel(m StatusModel) ServiceOption {
+	return func(s *ParcelService) {
+		s.model = m
+	}
+}
+
+// WithStatusCooldown запрещает NextStatus менять статус посылки
+// чаще, чем раз в period
+func WithStatusCooldown(period time.Duration) ServiceOption {
+	return func(s *ParcelService) {
+		s.cooldown = newStatusCooldown(period)
+	}
+}
+
+// WithClock задаёт источник времени, например фиксированные часы в тестах
+func WithClock(c Clock) ServiceOption {
+	return func(s *ParcelService) {
+		s.clock = c
+	}
+}
+
+// WithProgressEvery задаёт, через сколько посылок ExportJSONLProgress
+// сообщает о прогрессе выгрузки
+func WithProgressEvery(n int) ServiceOption {
+	return func(s *ParcelService) {
+		s.progressEvery = n
+	}
+}
+
+// WithSkipMalformedRows задаёт, пропускает ли ImportCSV некорректные строки
+// (true) или прерывает импорт с ошибкой (false, по умолчанию)
+func WithSkipMalformedRows(skip bool) ServiceOption {
+	return func(s *ParcelService) {
+		s.skipMalformed = skip
+	}
+}
+
+// WithMaxConcurrentExports ограничивает число одновременно выполняемых
+// выгрузок посылок: сверх него выгрузка сразу завершается с ErrBusy.
+// При n <= 0 ограничения нет (см. Config.MaxConcurrentExports)
+func WithMaxConcurrentExports(n int) ServiceOption {
+	return func(s *ParcelService) {
+		if n <= 0 {
+			s.exports = nil
+			return
+		}
+		s.exports = make(chan struct{}, n)
+	}
+}
+
+// WithConfig применяет к сервису параметры из cfg, относящиеся к нему:
+// сейчас это ограничение числа одновременных выгрузок
+func WithConfig(cfg Config) ServiceOption {
+	return WithMaxConcurrentExports(cfg.MaxConcurrentExports)
+}
+
+// WithMirror дублирует изменения посылок, выполненные через сервис,
+// в резервное хранилище secondary (см. MirrorStore)
+func WithMirror(secondary ParcelStorer) ServiceOption {
+	return func(s *ParcelService) {
+		s.mirror = &MirrorStore{secondary: secondary}
+	}
+}
+
+// WithAddressValidator задаёт проверку адресов при регистрации
+// и смене адреса вместо принимающей любой адрес
+func WithAddressValidator(v AddressValidator) ServiceOption {
+	return func(s *ParcelService) {
+		s.addressValidator = v
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger запоминает все сообщения сервиса
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+// skipSentModel модель, в которой посылка доставляется сразу после регистрации
+type skipSentModel struct{}
+
+func (skipSentModel) Next(status string) (string, bool) {
+	if status == ParcelStatusRegistered {
+		return ParcelStatusDelivered, true
+	}
+
+	return "", false
+}
+
+// fixedClock часы, всегда возвращающие одно и то же время
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+// TestNewParcelServiceOptions проверяет настройку сервиса опциями
+func TestNewParcelServiceOptions(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	logger := &recordingLogger{}
+	notifier := &recordingNotifier{}
+	model := skipSentModel{}
+
+	// defaults
+	service := NewParcelService(store)
+	require.Equal(t, stdoutLogger{}, service.logger)
+	require.Equal(t, realClock{}, service.clock)
+	require.Equal(t, linearStatusModel{}, service.model)
+	require.Nil(t, service.notifier)
+	require.Nil(t, service.cooldown)
+
+	// options
+	service = NewParcelService(store,
+		WithLogger(logger),
+		WithNotifier(notifier),
+		WithStatusModel(model),
+		WithStatusCooldown(time.Minute))
+	require.Same(t, logger, service.logger)
+	require.Same(t, notifier, service.notifier)
+	require.Equal(t, model, service.model)
+	require.Equal(t, time.Minute, service.cooldown.period)
+
+	// check
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	require.Len(t, logger.lines, 2)
+	require.Len(t, notifier.delivered, 1)
+	require.Equal(t, parcel.Number, notifier.delivered[0].Number)
+}
+
+// TestRegisterWithClock проверяет, что время регистрации берётся из часов сервиса
+func TestRegisterWithClock(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	now := time.Date(2024, 3, 1, 15, 4, 5, 0, time.FixedZone("MSK", 3*60*60))
+	service := NewParcelService(store, WithClock(fixedClock{now: now}))
+
+	// register
+	parcel, err := service.Register(1000, "test")
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, "2024-03-01T12:04:05Z", parcel.CreatedAt)
+
+	stored, err := store.Get(parcel.Number)
+	require.NoError(t, err)
+	require.Equal(t, parcel.CreatedAt, stored.CreatedAt)
+}
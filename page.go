@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrInvalidPageToken возвращается, когда курсор страницы не удаётся разобрать
+	ErrInvalidPageToken = errors.New("некорректный курсор страницы")
+	// ErrInvalidPageSize возвращается для неположительного размера страницы
+	ErrInvalidPageSize = errors.New("размер страницы должен быть положительным")
+)
+
+// PageByToken возвращает страницу из не более чем size посылок в порядке
+// возрастания номеров и курсор следующей страницы. Пустой token означает
+// первую страницу, пустой nextToken - что страниц больше нет. Курсор
+// непрозрачен для клиента: это номер последней посылки страницы в base64
+func (s ParcelStore) PageByToken(token string, size int) (parcels []Parcel, nextToken string, err error) {
+	if size <= 0 {
+		return nil, "", ErrInvalidPageSize
+	}
+
+	after := 0
+	if token != "" {
+		after, err = decodePageToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// запрашиваем на одну посылку больше, чтобы узнать, есть ли следующая страница
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE number > :after ORDER BY number ASC LIMIT :limit",
+		sql.Named("after", after),
+		sql.Named("limit", size+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	parcels, err = scanParcels(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(parcels) > size {
+		parcels = parcels[:size]
+		nextToken = encodePageToken(parcels[size-1].Number)
+	}
+
+	return parcels, nextToken, nil
+}
+
+// GetClientPageWithTotal возвращает не более limit посылок клиента в порядке
+// возрастания номеров, пропустив первые offset, и общее количество посылок
+// клиента. Оба значения читаются одним запросом благодаря COUNT(*) OVER ().
+// Только для страницы за концом списка количество запрашивается отдельно
+func (s ParcelStore) GetClientPageWithTotal(client, limit, offset int) (items []Parcel, total int, err error) {
+	if limit <= 0 {
+		return nil, 0, ErrInvalidPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+`, COUNT(*) OVER ()
+FROM parcel WHERE client = :client ORDER BY number ASC LIMIT :limit OFFSET :offset`,
+		sql.Named("client", client),
+		sql.Named("limit", limit),
+		sql.Named("offset", offset))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanParcel(extraScanner{rows, []interface{}{&total}})
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// за концом списка окно пустое, и количество из него не узнать
+	if len(items) == 0 && offset > 0 {
+		total, err = s.CountByClient(client)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return items, total, nil
+}
+
+func encodePageToken(number int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(number)))
+}
+
+func decodePageToken(token string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidPageToken, err)
+	}
+
+	number, err := strconv.Atoi(string(data))
+	if err != nil || number < 0 {
+		return 0, ErrInvalidPageToken
+	}
+
+	return number, nil
+}
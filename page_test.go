@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPageByToken проверяет обход всех посылок по курсорам страниц
+func TestPageByToken(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 7; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// walk
+	var got []int
+	var pages int
+	token := ""
+	for {
+		parcels, next, err := store.PageByToken(token, 3)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(parcels), 3)
+		for _, parcel := range parcels {
+			got = append(got, parcel.Number)
+		}
+		pages++
+
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	// check
+	require.Equal(t, numbers, got)
+	require.Equal(t, 3, pages)
+
+	// ровно одна полная страница не требует пустой следующей
+	parcels, next, err := store.PageByToken("", len(numbers))
+	require.NoError(t, err)
+	require.Len(t, parcels, len(numbers))
+	require.Empty(t, next)
+
+	_, _, err = store.PageByToken("not a token!", 3)
+	require.ErrorIs(t, err, ErrInvalidPageToken)
+
+	_, _, err = store.PageByToken("", 0)
+	require.ErrorIs(t, err, ErrInvalidPageSize)
+}
+
+// TestGetClientPageWithTotal проверяет страницы посылок клиента с общим количеством
+func TestGetClientPageWithTotal(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := 1000
+	var numbers []int
+	for i := 0; i < 5; i++ {
+		parcel := getTestParcel()
+		parcel.Client = client
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	other := getTestParcel()
+	other.Client = client + 1
+	_, err := store.Add(other)
+	require.NoError(t, err)
+
+	// walk
+	var got []int
+	for offset := 0; offset < len(numbers); offset += 2 {
+		items, total, err := store.GetClientPageWithTotal(client, 2, offset)
+		require.NoError(t, err)
+		require.Equal(t, len(numbers), total)
+		require.LessOrEqual(t, len(items), 2)
+		for _, p := range items {
+			require.Equal(t, client, p.Client)
+			got = append(got, p.Number)
+		}
+	}
+
+	// check
+	require.Equal(t, numbers, got)
+
+	items, total, err := store.GetClientPageWithTotal(client, 2, 10)
+	require.NoError(t, err)
+	require.Empty(t, items)
+	require.Equal(t, len(numbers), total)
+
+	items, total, err = store.GetClientPageWithTotal(client+2, 2, 0)
+	require.NoError(t, err)
+	require.Empty(t, items)
+	require.Zero(t, total)
+
+	_, _, err = store.GetClientPageWithTotal(client, 0, 0)
+	require.ErrorIs(t, err, ErrInvalidPageSize)
+}
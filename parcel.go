@@ -1,60 +1,1332 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 )
 
+var (
+	// ErrParcelNotFound возвращается, когда посылки с заданным номером нет
+	ErrParcelNotFound = errors.New("посылка не найдена")
+	// ErrNotRegistered возвращается, когда операция допустима
+	// только для посылки в статусе registered
+	ErrNotRegistered = errors.New("посылка не в статусе registered")
+	// ErrNotSQLite возвращается операциями, которые поддерживает только SQLite
+	ErrNotSQLite = errors.New("операция поддерживается только для SQLite")
+	// ErrInTransaction возвращается операциями, которые нельзя выполнить
+	// внутри транзакции
+	ErrInTransaction = errors.New("операцию нельзя выполнить внутри транзакции")
+	// ErrVersionConflict возвращается, когда посылку изменили
+	// после того, как была прочитана ожидаемая версия
+	ErrVersionConflict = errors.New("посылка была изменена параллельно")
+	// ErrInvalidDimensions возвращается для отрицательного веса или габаритов
+	ErrInvalidDimensions = errors.New("вес и габариты посылки не могут быть отрицательными")
+	// ErrInvalidRange возвращается, когда начало диапазона больше его конца
+	ErrInvalidRange = errors.New("начало диапазона больше конца")
+)
+
+// querier выполняет запросы хранилища к *sql.DB или *sql.Tx (см. timeoutQuerier)
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (sqlRows, error)
+	QueryRow(query string, args ...interface{}) sqlRow
+}
+
+// sqlRows часть *sql.Rows, которой пользуется хранилище
+type sqlRows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// sqlRow часть *sql.Row, которой пользуется хранилище
+type sqlRow interface {
+	Scan(dest ...interface{}) error
+}
+
 type ParcelStore struct {
 	db *sql.DB
+	// q выполняет запросы к db либо к транзакции, внутри которой работает хранилище
+	q querier
+	// tx транзакция, внутри которой работает хранилище, или nil
+	tx *sql.Tx
+	// timeout ограничивает время каждой операции, 0 - без ограничения
+	timeout time.Duration
+	// counts кеш CountByStatusCached, общий для всех копий хранилища
+	counts *statusCountCache
 }
 
 func NewParcelStore(db *sql.DB) ParcelStore {
-	return ParcelStore{db: db}
+	counts := &statusCountCache{}
+
+	return ParcelStore{db: db, q: counts.wrap(timeoutQuerier{q: db, parent: context.Background()}), counts: counts}
+}
+
+// parcelColumns столбцы таблицы parcel в том порядке, в котором их читает scanParcel
+const parcelColumns = "number, client, status, address, created_at, priority, attempts, version, weight_grams, length_mm, width_mm, height_mm, claimed_by, claimed_at"
+
+// scanParcel читает посылку из строки результата, выбранной со столбцами parcelColumns
+func scanParcel(s interface{ Scan(...interface{}) error }) (Parcel, error) {
+	p := Parcel{}
+	err := s.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt, &p.Priority, &p.Attempts, &p.Version,
+		&p.WeightGrams, &p.LengthMM, &p.WidthMM, &p.HeightMM, &p.ClaimedBy, &p.ClaimedAt)
+
+	return p, err
+}
+
+// scanParcels читает все посылки из rows и закрывает rows
+func scanParcels(rows sqlRows) ([]Parcel, error) {
+	defer rows.Close()
+
+	var res []Parcel
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReadTx выполняет fn внутри транзакции только для чтения, так что все
+// чтения через переданный в fn ParcelStore видят один и тот же снимок БД
+func (s ParcelStore) ReadTx(fn func(ParcelStore) error) error {
+	return s.inTx(&sql.TxOptions{ReadOnly: true}, fn)
+}
+
+// WithTx выполняет fn внутри транзакции: если fn вернула ошибку,
+// все изменения, сделанные через переданный в fn ParcelStore, откатываются
+func (s ParcelStore) WithTx(fn func(ParcelStore) error) error {
+	return s.inTx(nil, fn)
+}
+
+// inTx выполняет fn внутри транзакции с параметрами opts и фиксирует её,
+// если fn не вернула ошибку. Если хранилище уже работает в транзакции,
+// fn выполняется в ней же
+func (s ParcelStore) inTx(opts *sql.TxOptions, fn func(ParcelStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	// таймаут ограничивает всю транзакцию, а не каждый её запрос отдельно
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := timeoutQuerier{q: tx, parent: ctx, timeout: s.timeout}
+	inner := ParcelStore{db: s.db, q: s.counts.wrap(q), tx: tx, timeout: s.timeout, counts: s.counts}
+	if err := fn(inner); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// кеш могли заполнить до фиксации транзакции, пока изменения не были видны
+	s.counts.invalidate()
+
+	return nil
 }
 
 func (s ParcelStore) Add(p Parcel) (int, error) {
-	// реализуйте добавление строки в таблицу parcel, используйте данные из переменной p
+	var id int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		// добавляем строку в таблицу parcel, используя данные из переменной p
+		// статус посылки установлен в момент её создания
+		res, err := tx.q.Exec(`INSERT INTO parcel (client, status, address, created_at, status_changed_at, priority, attempts, delivered_at,
+    weight_grams, length_mm, width_mm, height_mm)
+VALUES (:client, :status, :address, :created_at, :created_at, :priority, :attempts, CASE WHEN :status = :delivered THEN :created_at ELSE '' END,
+    :weight_grams, :length_mm, :width_mm, :height_mm)`,
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("client", p.Client),
+			sql.Named("status", p.Status),
+			sql.Named("address", p.Address),
+			sql.Named("created_at", p.CreatedAt),
+			sql.Named("priority", p.Priority),
+			sql.Named("attempts", p.Attempts),
+			sql.Named("weight_grams", p.WeightGrams),
+			sql.Named("length_mm", p.LengthMM),
+			sql.Named("width_mm", p.WidthMM),
+			sql.Named("height_mm", p.HeightMM))
+		if err != nil {
+			return err
+		}
 
-	// верните идентификатор последней добавленной записи
-	return 0, nil
+		// возвращаем идентификатор последней добавленной записи
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = int(lastID)
+
+		if err := tx.addChange(id, ChangeAdd); err != nil {
+			return err
+		}
+
+		return tx.addHistory(id, p.Status, p.CreatedAt)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
 }
 
 func (s ParcelStore) Get(number int) (Parcel, error) {
-	// реализуйте чтение строки по заданному number
+	// читаем строку по заданному number
 	// здесь из таблицы должна вернуться только одна строка
+	row := s.q.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE number = :number",
+		sql.Named("number", number))
 
-	// заполните объект Parcel данными из таблицы
-	p := Parcel{}
-
-	return p, nil
+	// заполняем объект Parcel данными из таблицы
+	return scanParcel(row)
 }
 
 func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
-	// реализуйте чтение строк из таблицы parcel по заданному client
+	// читаем строки из таблицы parcel по заданному client
 	// здесь из таблицы может вернуться несколько строк
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE client = :client",
+		sql.Named("client", client))
+	if err != nil {
+		return nil, err
+	}
 
-	// заполните срез Parcel данными из таблицы
-	var res []Parcel
-
-	return res, nil
+	// заполняем срез Parcel данными из таблицы
+	return scanParcels(rows)
 }
 
 func (s ParcelStore) SetStatus(number int, status string) error {
-	// реализуйте обновление статуса в таблице parcel
+	changedAt := time.Now().UTC().Format(time.RFC3339)
 
-	return nil
+	return s.inTx(nil, func(tx ParcelStore) error {
+		// обновляем статус в таблице parcel и запоминаем время его смены,
+		// а для доставленной посылки и время доставки. Если статус
+		// уже такой, посылка не меняется
+		res, err := tx.q.Exec(setStatusQuery+" WHERE number = :number AND status != :status",
+			sql.Named("status", status),
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("processing", ParcelStatusProcessing),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChangeIfUpdated(res, number, ChangeSetStatus); err != nil {
+			return err
+		}
+
+		return tx.addHistoryIfUpdated(res, number, status, changedAt)
+	})
+}
+
+// setStatusQuery общая часть запросов смены статуса без условия WHERE.
+// Посылка, выведенная из статуса processing, перестаёт быть взятой в работу
+const setStatusQuery = `UPDATE parcel SET status = :status, status_changed_at = :changed_at,
+    delivered_at = CASE WHEN :status = :delivered THEN :changed_at ELSE delivered_at END,
+    claimed_by = CASE WHEN :status = :processing THEN claimed_by ELSE '' END,
+    claimed_at = CASE WHEN :status = :processing THEN claimed_at ELSE '' END,
+    version = version + 1`
+
+// SetStatusCAS меняет статус посылки, только если её версия всё ещё равна
+// expectedVersion, и возвращает новую версию. Если посылку уже изменили,
+// возвращается ErrVersionConflict. Если статус уже такой, посылка
+// не меняется и возвращается expectedVersion
+func (s ParcelStore) SetStatusCAS(number int, expectedVersion int, status string) (newVersion int, err error) {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+
+	err = s.inTx(nil, func(tx ParcelStore) error {
+		res, err := tx.q.Exec(setStatusQuery+" WHERE number = :number AND version = :version AND status != :status",
+			sql.Named("status", status),
+			sql.Named("delivered", ParcelStatusDelivered),
+			sql.Named("processing", ParcelStatusProcessing),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", number),
+			sql.Named("version", expectedVersion))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			p, err := tx.Get(number)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrParcelNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if p.Version != expectedVersion {
+				return ErrVersionConflict
+			}
+			newVersion = expectedVersion
+			return nil
+		}
+		newVersion = expectedVersion + 1
+
+		if err := tx.addChange(number, ChangeSetStatus); err != nil {
+			return err
+		}
+
+		return tx.addHistory(number, status, changedAt)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, nil
+}
+
+// SetClient передаёт посылку другому клиенту
+func (s ParcelStore) SetClient(number int, client int) error {
+	_, err := s.q.Exec("UPDATE parcel SET client = :client, version = version + 1 WHERE number = :number",
+		sql.Named("client", client),
+		sql.Named("number", number))
+
+	return err
+}
+
+// MarkFailed переводит посылку в статус failed
+// и увеличивает счётчик неудачных попыток доставки
+func (s ParcelStore) MarkFailed(number int) error {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+
+	return s.inTx(nil, func(tx ParcelStore) error {
+		res, err := tx.q.Exec("UPDATE parcel SET status = :status, status_changed_at = :changed_at, attempts = attempts + 1, claimed_by = '', claimed_at = '', version = version + 1 WHERE number = :number",
+			sql.Named("status", ParcelStatusFailed),
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", number))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChangeIfUpdated(res, number, ChangeSetStatus); err != nil {
+			return err
+		}
+
+		return tx.addHistoryIfUpdated(res, number, ParcelStatusFailed, changedAt)
+	})
+}
+
+// ResetAttempts обнуляет счётчик неудачных попыток доставки
+func (s ParcelStore) ResetAttempts(number int) error {
+	_, err := s.q.Exec("UPDATE parcel SET attempts = 0, version = version + 1 WHERE number = :number",
+		sql.Named("number", number))
+
+	return err
+}
+
+// SetDimensions сохраняет вес посылки w в граммах и её длину l, ширину wd
+// и высоту h в миллиметрах. Отрицательные значения отклоняются с ErrInvalidDimensions
+func (s ParcelStore) SetDimensions(number int, w, l, wd, h int) error {
+	if w < 0 || l < 0 || wd < 0 || h < 0 {
+		return ErrInvalidDimensions
+	}
+
+	_, err := s.q.Exec("UPDATE parcel SET weight_grams = :weight, length_mm = :length, width_mm = :width, height_mm = :height, version = version + 1 WHERE number = :number",
+		sql.Named("weight", w),
+		sql.Named("length", l),
+		sql.Named("width", wd),
+		sql.Named("height", h),
+		sql.Named("number", number))
+
+	return err
+}
+
+// SetPriority устанавливает или снимает у посылки признак срочной обработки
+func (s ParcelStore) SetPriority(number int, priority bool) error {
+	_, err := s.q.Exec("UPDATE parcel SET priority = :priority, version = version + 1 WHERE number = :number",
+		sql.Named("priority", priority),
+		sql.Named("number", number))
+
+	return err
 }
 
 func (s ParcelStore) SetAddress(number int, address string) error {
-	// реализуйте обновление адреса в таблице parcel
-	// менять адрес можно только если значение статуса registered
+	return s.inTx(nil, func(tx ParcelStore) error {
+		// обновляем адрес в таблице parcel
+		// менять адрес можно только если значение статуса registered
+		res, err := tx.q.Exec("UPDATE parcel SET address = :address, version = version + 1 WHERE number = :number AND status = :status",
+			sql.Named("address", address),
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusRegistered))
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return tx.addChangeIfUpdated(res, number, ChangeSetAddress)
+	})
 }
 
 func (s ParcelStore) Delete(number int) error {
-	// реализуйте удаление строки из таблицы parcel
+	// удаляем строку из таблицы parcel, сохранив её копию в parcel_deleted
 	// удалять строку можно только если значение статуса registered
+	_, err := s.deleteWhere("number = :number AND status = :status",
+		sql.Named("number", number),
+		sql.Named("status", ParcelStatusRegistered))
 
-	return nil
+	return err
+}
+
+// Truncate удаляет все посылки вместе с их историей, архивом, копиями
+// удалённых посылок и журналом изменений и сбрасывает счётчики
+// AUTOINCREMENT, так что следующая посылка снова получит номер 1.
+// Предназначен для сброса БД в тестах
+func (s ParcelStore) Truncate() error {
+	return s.inTx(nil, func(tx ParcelStore) error {
+		for _, table := range []string{"parcel", "parcel_history", "parcel_archive", "parcel_deleted", "changelog"} {
+			if _, err := tx.q.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.q.Exec("DELETE FROM sqlite_sequence WHERE name IN ('parcel', 'parcel_history', 'changelog')")
+
+		return err
+	})
+}
+
+// GetAllChronological возвращает все посылки в порядке их создания,
+// limit ограничивает количество строк, 0 означает без ограничения
+func (s ParcelStore) GetAllChronological(limit int) ([]Parcel, error) {
+	// в SQLite отрицательный LIMIT снимает ограничение
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel ORDER BY created_at ASC, number ASC LIMIT :limit",
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// DeleteAllForClient безвозвратно удаляет все данные клиента: посылки
+// в любом статусе, архив, копии удалённых посылок, историю статусов
+// и журнал изменений этих посылок. Копия в parcel_deleted, в отличие
+// от Delete, не сохраняется. Возвращает количество удалённых посылок
+// вместе с архивными
+func (s ParcelStore) DeleteAllForClient(client int) (int, error) {
+	var deleted int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		// история и журнал хранят только номер посылки, поэтому
+		// удаляются первыми, пока номера клиента ещё можно найти
+		for _, table := range []string{"parcel_history", "changelog"} {
+			_, err := tx.q.Exec("DELETE FROM "+table+` WHERE number IN (
+    SELECT number FROM parcel WHERE client = :client
+    UNION SELECT number FROM parcel_archive WHERE client = :client
+    UNION SELECT number FROM parcel_deleted WHERE client = :client
+)`,
+				sql.Named("client", client))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.q.Exec("DELETE FROM parcel_deleted WHERE client = :client",
+			sql.Named("client", client))
+		if err != nil {
+			return err
+		}
+
+		for _, table := range []string{"parcel", "parcel_archive"} {
+			res, err := tx.q.Exec("DELETE FROM "+table+" WHERE client = :client",
+				sql.Named("client", client))
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += int(n)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// FindFutureDated возвращает посылки, время создания которых позже now,
+// например из-за расхождения часов. Время сравнивается через julianday,
+// поэтому учитывается и смещение часового пояса в created_at
+func (s ParcelStore) FindFutureDated(now time.Time) ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE julianday(created_at) > julianday(:now) ORDER BY created_at ASC, number ASC",
+		sql.Named("now", now.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// StuckInSent возвращает отправленные посылки, статус которых
+// не менялся с момента sentBefore
+func (s ParcelStore) StuckInSent(sentBefore time.Time) ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE status = :status AND status_changed_at < :before ORDER BY status_changed_at ASC, number ASC",
+		sql.Named("status", ParcelStatusSent),
+		sql.Named("before", sentBefore.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// SetAddressBulk в одной транзакции обновляет адреса посылок из updates
+// (ключ - номер посылки, значение - новый адрес) и возвращает количество
+// обновлённых посылок. Как и в SetAddress, меняются только посылки
+// в статусе registered
+func (s ParcelStore) SetAddressBulk(updates map[int]string) (int, error) {
+	var updated int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		for number, address := range updates {
+			res, err := tx.q.Exec("UPDATE parcel SET address = :address, version = version + 1 WHERE number = :number AND status = :status",
+				sql.Named("address", address),
+				sql.Named("number", number),
+				sql.Named("status", ParcelStatusRegistered))
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				if err := tx.addChange(number, ChangeSetAddress); err != nil {
+					return err
+				}
+			}
+			updated += int(n)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// SwapAddresses в одной транзакции меняет местами адреса посылок a и b.
+// Обе посылки должны существовать и быть в статусе registered, иначе
+// возвращается ErrParcelNotFound или ErrNotRegistered и адреса не меняются
+func (s ParcelStore) SwapAddresses(a, b int) error {
+	return s.inTx(nil, func(tx ParcelStore) error {
+		var parcels [2]Parcel
+		for i, number := range []int{a, b} {
+			p, err := tx.Get(number)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("посылка %d: %w", number, ErrParcelNotFound)
+			}
+			if err != nil {
+				return err
+			}
+			if p.Status != ParcelStatusRegistered {
+				return fmt.Errorf("посылка %d: %w", number, ErrNotRegistered)
+			}
+			parcels[i] = p
+		}
+
+		if err := tx.SetAddress(a, parcels[1].Address); err != nil {
+			return err
+		}
+
+		return tx.SetAddress(b, parcels[0].Address)
+	})
+}
+
+// OldestUndeliveredPerClient возвращает для каждого клиента самую раннюю
+// по created_at посылку, которая ещё не доставлена. Ключ map - идентификатор клиента
+func (s ParcelStore) OldestUndeliveredPerClient() (map[int]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+` FROM (
+    SELECT *, ROW_NUMBER() OVER (PARTITION BY client ORDER BY created_at ASC, number ASC) AS rn
+    FROM parcel WHERE status != :status
+) WHERE rn = 1`,
+		sql.Named("status", ParcelStatusDelivered))
+	if err != nil {
+		return nil, err
+	}
+
+	parcels, err := scanParcels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]Parcel, len(parcels))
+	for _, p := range parcels {
+		res[p.Client] = p
+	}
+
+	return res, nil
+}
+
+// GetByMonth возвращает посылки, созданные в указанном месяце года (по UTC)
+func (s ParcelStore) GetByMonth(year int, month time.Month) ([]Parcel, error) {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	// AddDate сам учитывает длину месяца и високосные годы
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE created_at >= :start AND created_at < :end ORDER BY created_at ASC, number ASC",
+		sql.Named("start", start.Format(time.RFC3339)),
+		sql.Named("end", end.Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// GetStatus возвращает только статус посылки, не читая остальные поля
+func (s ParcelStore) GetStatus(number int) (string, error) {
+	var status string
+	err := s.q.QueryRow("SELECT status FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrParcelNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
+
+// GetProcessingQueue возвращает зарегистрированные посылки в порядке
+// обработки: сначала срочные, внутри одной срочности - более старые
+func (s ParcelStore) GetProcessingQueue() ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE status = :status ORDER BY priority DESC, created_at ASC, number ASC",
+		sql.Named("status", ParcelStatusRegistered))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// ForEach по очереди передаёт в fn все посылки в порядке номеров,
+// не загружая их в память целиком. Первая ошибка fn прерывает обход
+func (s ParcelStore) ForEach(fn func(Parcel) error) error {
+	rows, err := s.q.Query("SELECT " + parcelColumns + " FROM parcel ORDER BY number ASC")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// countWhere возвращает количество посылок, подходящих под условие clause.
+// clause подставляется в запрос после WHERE как есть, поэтому значения
+// должны передаваться только через args
+func (s ParcelStore) countWhere(clause string, args ...interface{}) (int, error) {
+	var n int
+	err := s.q.QueryRow("SELECT COUNT(*) FROM parcel WHERE "+clause, args...).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// CountByClient возвращает количество посылок клиента
+func (s ParcelStore) CountByClient(client int) (int, error) {
+	return s.countWhere("client = :client", sql.Named("client", client))
+}
+
+// CountByStatus возвращает количество посылок в статусе status
+func (s ParcelStore) CountByStatus(status string) (int, error) {
+	return s.countWhere("status = :status", sql.Named("status", status))
+}
+
+// HasUndelivered сообщает, есть ли у клиента ещё не доставленные посылки
+func (s ParcelStore) HasUndelivered(client int) (bool, error) {
+	var exists bool
+	err := s.q.QueryRow("SELECT EXISTS(SELECT 1 FROM parcel WHERE client = :client AND status != :delivered)",
+		sql.Named("client", client),
+		sql.Named("delivered", ParcelStatusDelivered)).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// AllDelivered сообщает, что у клиента есть посылки и все они доставлены
+func (s ParcelStore) AllDelivered(client int) (bool, error) {
+	var delivered bool
+	err := s.q.QueryRow("SELECT COUNT(*) > 0 AND COALESCE(SUM(status != :delivered), 0) = 0 FROM parcel WHERE client = :client",
+		sql.Named("client", client),
+		sql.Named("delivered", ParcelStatusDelivered)).Scan(&delivered)
+	if err != nil {
+		return false, err
+	}
+
+	return delivered, nil
+}
+
+// HasActiveDuplicate сообщает, есть ли у клиента зарегистрированная,
+// но ещё не отправленная посылка на адрес address
+func (s ParcelStore) HasActiveDuplicate(client int, address string) (bool, error) {
+	var exists bool
+	err := s.q.QueryRow("SELECT EXISTS(SELECT 1 FROM parcel WHERE client = :client AND address = :address AND status = :registered)",
+		sql.Named("client", client),
+		sql.Named("address", address),
+		sql.Named("registered", ParcelStatusRegistered)).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Since возвращает посылки с номером больше lastNumber в порядке возрастания
+// номеров. Используется как простая лента изменений для синхронизации
+func (s ParcelStore) Since(lastNumber int) ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE number > :number ORDER BY number ASC",
+		sql.Named("number", lastNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// FindNumberGaps возвращает диапазоны [от, до] пропущенных номеров
+// между существующими посылками, например после удалений
+func (s ParcelStore) FindNumberGaps() ([][2]int, error) {
+	rows, err := s.q.Query(`SELECT prev + 1, number - 1 FROM (
+    SELECT number, LAG(number) OVER (ORDER BY number) AS prev FROM parcel
+) WHERE number - prev > 1 ORDER BY number`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res [][2]int
+	for rows.Next() {
+		var gap [2]int
+		if err := rows.Scan(&gap[0], &gap[1]); err != nil {
+			return nil, err
+		}
+
+		res = append(res, gap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DeliveriesPerDay возвращает количество доставок за каждый день (по UTC)
+// в интервале [from, to). Ключ map - дата в формате YYYY-MM-DD
+func (s ParcelStore) DeliveriesPerDay(from, to time.Time) (map[string]int, error) {
+	rows, err := s.q.Query("SELECT substr(delivered_at, 1, 10) AS day, COUNT(*) FROM parcel WHERE status = :status AND delivered_at >= :from AND delivered_at < :to GROUP BY day",
+		sql.Named("status", ParcelStatusDelivered),
+		sql.Named("from", from.UTC().Format(time.RFC3339)),
+		sql.Named("to", to.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var day string
+		var n int
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+
+		res[day] = n
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// FindInvalid возвращает посылки с неизвестным статусом или пустым адресом,
+// попавшие в таблицу до появления проверок
+func (s ParcelStore) FindInvalid() ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+` FROM parcel
+WHERE status NOT IN (:registered, :sent, :delivered, :failed, :processing) OR trim(address) = ''
+ORDER BY number ASC`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("failed", ParcelStatusFailed),
+		sql.Named("processing", ParcelStatusProcessing))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// Stats возвращает статистику пула соединений БД: сколько соединений
+// открыто, простаивает и занято, для экспорта в метрики
+func (s ParcelStore) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Vacuum перестраивает файл БД, освобождая место после массовых удалений.
+// VACUUM нельзя выполнить внутри транзакции, поэтому в ней возвращается
+// ErrInTransaction, а для БД, отличной от SQLite, - ErrNotSQLite
+func (s ParcelStore) Vacuum() error {
+	if s.tx != nil {
+		return ErrInTransaction
+	}
+
+	var version string
+	if err := s.db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotSQLite, err)
+	}
+
+	_, err := s.db.Exec("VACUUM")
+
+	return err
+}
+
+// QueuePosition возвращает место (начиная с 1) зарегистрированной посылки
+// среди зарегистрированных посылок того же клиента в порядке создания.
+// Для посылки в другом статусе возвращается ErrNotRegistered
+func (s ParcelStore) QueuePosition(number int) (int, error) {
+	p, err := s.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParcelNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if p.Status != ParcelStatusRegistered {
+		return 0, ErrNotRegistered
+	}
+
+	n, err := s.countWhere("client = :client AND status = :status AND (created_at < :created_at OR (created_at = :created_at AND number < :number))",
+		sql.Named("client", p.Client),
+		sql.Named("status", ParcelStatusRegistered),
+		sql.Named("created_at", p.CreatedAt),
+		sql.Named("number", p.Number))
+	if err != nil {
+		return 0, err
+	}
+
+	return n + 1, nil
+}
+
+// ParcelWithPosition посылка вместе с её местом в очереди (см. QueuePosition),
+// для посылок не в статусе registered Position равен 0
+type ParcelWithPosition struct {
+	Parcel
+	Position int `json:"position"`
+}
+
+// GetByClientWithPositions возвращает посылки клиента в порядке создания
+// вместе с местом каждой в очереди, вычисляя все места одним запросом
+func (s ParcelStore) GetByClientWithPositions(client int) ([]ParcelWithPosition, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+`,
+    CASE WHEN status = :registered
+        THEN ROW_NUMBER() OVER (PARTITION BY status = :registered ORDER BY created_at ASC, number ASC)
+        ELSE 0
+    END
+FROM parcel WHERE client = :client ORDER BY created_at ASC, number ASC`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("client", client))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []ParcelWithPosition
+	for rows.Next() {
+		var position int
+		p, err := scanParcel(extraScanner{rows, []interface{}{&position}})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ParcelWithPosition{Parcel: p, Position: position})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// extraScanner дочитывает после столбцов parcelColumns дополнительные
+// столбцы строки в extra, чтобы для таких запросов можно было
+// использовать scanParcel
+type extraScanner struct {
+	rows  sqlRows
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
+
+// DistinctAddresses возвращает уникальные адреса посылок клиента
+// в алфавитном порядке
+func (s ParcelStore) DistinctAddresses(client int) ([]string, error) {
+	rows, err := s.q.Query("SELECT DISTINCT address FROM parcel WHERE client = :client ORDER BY address ASC",
+		sql.Named("client", client))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, err
+		}
+
+		res = append(res, address)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DispatchAllRegistered в одной транзакции переводит все зарегистрированные
+// посылки в статус sent и возвращает количество отправленных посылок.
+// Посылки без адреса не отправляются и остаются в статусе registered
+func (s ParcelStore) DispatchAllRegistered() (int, error) {
+	changedAt := time.Now().UTC().Format(time.RFC3339)
+	where := "status = :registered AND TRIM(address) != ''"
+
+	var dispatched int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		_, err := tx.q.Exec("INSERT INTO parcel_history (number, status, changed_at) SELECT number, :sent, :changed_at FROM parcel WHERE "+where,
+			sql.Named("sent", ParcelStatusSent),
+			sql.Named("changed_at", changedAt),
+			sql.Named("registered", ParcelStatusRegistered))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.addChangesWhere(ChangeSetStatus, where, sql.Named("registered", ParcelStatusRegistered)); err != nil {
+			return err
+		}
+
+		res, err := tx.q.Exec("UPDATE parcel SET status = :sent, status_changed_at = :changed_at, version = version + 1 WHERE "+where,
+			sql.Named("sent", ParcelStatusSent),
+			sql.Named("changed_at", changedAt),
+			sql.Named("registered", ParcelStatusRegistered))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		dispatched = int(n)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return dispatched, nil
+}
+
+// SearchByAddressRegex возвращает посылки, адрес которых подходит под
+// регулярное выражение pattern (синтаксис пакета regexp). В SQLite нет
+// встроенного REGEXP, поэтому фильтрация идёт на стороне Go
+func (s ParcelStore) SearchByAddressRegex(pattern string) ([]Parcel, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Parcel
+	err = s.ForEach(func(p Parcel) error {
+		if re.MatchString(p.Address) {
+			res = append(res, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetByCity возвращает посылки, в адресе которых город city указан отдельной
+// частью адреса: адрес начинается с "city," или равен city, либо содержит
+// ", city," или заканчивается на ", city". Так "Псков" не совпадёт
+// с "Псковская обл." или "ул. Псковская". Для латиницы сравнение
+// без учёта регистра (как LIKE в SQLite), для кириллицы - с учётом
+func (s ParcelStore) GetByCity(city string) ([]Parcel, error) {
+	city = escapeLike(strings.TrimSpace(city))
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+` FROM parcel
+WHERE address LIKE :exact ESCAPE '\'
+   OR address LIKE :prefix ESCAPE '\'
+   OR address LIKE :middle ESCAPE '\'
+   OR address LIKE :suffix ESCAPE '\'
+ORDER BY number ASC`,
+		sql.Named("exact", city),
+		sql.Named("prefix", city+",%"),
+		sql.Named("middle", "%, "+city+",%"),
+		sql.Named("suffix", "%, "+city))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// escapeLike экранирует символом \ спецсимволы LIKE в s,
+// чтобы строка сравнивалась буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Total возвращает общее количество посылок
+func (s ParcelStore) Total() (int, error) {
+	var n int
+	err := s.q.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// RandomSample возвращает n случайных посылок для выборочной проверки.
+// Если посылок меньше n, возвращаются все, а при n <= 0 - ни одной
+func (s ParcelStore) RandomSample(n int) ([]Parcel, error) {
+	// в SQLite отрицательный LIMIT снимает ограничение
+	if n <= 0 {
+		return nil, nil
+	}
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel ORDER BY RANDOM() LIMIT :limit",
+		sql.Named("limit", n))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// NeverDispatched возвращает посылки, которые с момента создания так и
+// остались в статусе registered, начиная с самых старых
+func (s ParcelStore) NeverDispatched() ([]Parcel, error) {
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE status = :status ORDER BY created_at ASC, number ASC",
+		sql.Named("status", ParcelStatusRegistered))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// OldestRegistered возвращает n самых старых зарегистрированных посылок
+// в порядке создания для обработки по принципу FIFO. При n <= 0
+// возвращается пустой список
+func (s ParcelStore) OldestRegistered(n int) ([]Parcel, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE status = :status ORDER BY created_at ASC, number ASC LIMIT :limit",
+		sql.Named("status", ParcelStatusRegistered),
+		sql.Named("limit", n))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// Board возвращает все посылки, сгруппированные по статусу. Внутри каждой
+// группы посылки упорядочены по времени создания
+func (s ParcelStore) Board() (map[string][]Parcel, error) {
+	rows, err := s.q.Query("SELECT " + parcelColumns + " FROM parcel ORDER BY created_at ASC, number ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	parcels, err := scanParcels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	board := map[string][]Parcel{}
+	for _, p := range parcels {
+		board[p.Status] = append(board[p.Status], p)
+	}
+
+	return board, nil
+}
+
+// GetByClientMap возвращает посылки клиента в виде map с номером посылки в качестве ключа
+func (s ParcelStore) GetByClientMap(client int) (map[int]Parcel, error) {
+	parcels, err := s.GetByClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]Parcel, len(parcels))
+	for _, p := range parcels {
+		res[p.Number] = p
+	}
+
+	return res, nil
+}
+
+// inNumbers строит условие "number IN (...)" с именованными параметрами
+// для каждого номера из numbers
+func inNumbers(numbers []int) (string, []interface{}) {
+	names := make([]string, len(numbers))
+	args := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		name := fmt.Sprintf("n%d", i)
+		names[i] = ":" + name
+		args[i] = sql.Named(name, number)
+	}
+
+	return "number IN (" + strings.Join(names, ", ") + ")", args
+}
+
+// DeleteByNumbers удаляет посылки с номерами из numbers, если они ещё
+// в статусе registered, и возвращает количество удалённых посылок
+func (s ParcelStore) DeleteByNumbers(numbers []int) (int, error) {
+	if len(numbers) == 0 {
+		return 0, nil
+	}
+
+	clause, args := inNumbers(numbers)
+	args = append(args, sql.Named("status", ParcelStatusRegistered))
+
+	return s.deleteWhere(clause+" AND status = :status", args...)
+}
+
+// ShiftCreatedAt в одной транзакции сдвигает время создания посылок
+// с номерами из numbers на delta, например для исправления неверного
+// часового пояса, и возвращает количество изменённых посылок.
+// Вместе с created_at на delta сдвигаются время смены статуса, время
+// доставки и запись истории о создании посылки
+func (s ParcelStore) ShiftCreatedAt(numbers []int, delta time.Duration) (int, error) {
+	if len(numbers) == 0 {
+		return 0, nil
+	}
+
+	var shifted int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		clause, args := inNumbers(numbers)
+		rows, err := tx.q.Query("SELECT number, created_at, status_changed_at, delivered_at FROM parcel WHERE "+clause, args...)
+		if err != nil {
+			return err
+		}
+
+		// times время создания, смены статуса и доставки посылки
+		times := map[int][3]string{}
+		for rows.Next() {
+			var number int
+			var at [3]string
+			if err := rows.Scan(&number, &at[0], &at[1], &at[2]); err != nil {
+				rows.Close()
+				return err
+			}
+			times[number] = at
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for number, at := range times {
+			for i := range at {
+				if at[i] == "" {
+					continue
+				}
+				parsed, err := time.Parse(time.RFC3339, at[i])
+				if err != nil {
+					return fmt.Errorf("посылка %d: %w", number, err)
+				}
+				at[i] = parsed.Add(delta).UTC().Format(time.RFC3339)
+			}
+
+			_, err = tx.q.Exec("UPDATE parcel SET created_at = :created_at, status_changed_at = :status_changed_at, delivered_at = :delivered_at, version = version + 1 WHERE number = :number",
+				sql.Named("created_at", at[0]),
+				sql.Named("status_changed_at", at[1]),
+				sql.Named("delivered_at", at[2]),
+				sql.Named("number", number))
+			if err != nil {
+				return err
+			}
+
+			// первая запись истории - о создании посылки
+			_, err = tx.q.Exec("UPDATE parcel_history SET changed_at = :created_at WHERE id = (SELECT MIN(id) FROM parcel_history WHERE number = :number)",
+				sql.Named("created_at", at[0]),
+				sql.Named("number", number))
+			if err != nil {
+				return err
+			}
+		}
+		shifted = len(times)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return shifted, nil
+}
+
+// GetStatuses возвращает статусы посылок с номерами из numbers одним запросом.
+// Несуществующих номеров в результате нет
+func (s ParcelStore) GetStatuses(numbers []int) (map[int]string, error) {
+	res := make(map[int]string, len(numbers))
+	if len(numbers) == 0 {
+		return res, nil
+	}
+
+	clause, args := inNumbers(numbers)
+	rows, err := s.q.Query("SELECT number, status FROM parcel WHERE "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number int
+		var status string
+		if err := rows.Scan(&number, &status); err != nil {
+			return nil, err
+		}
+		res[number] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetNumberRange возвращает посылки с номерами из диапазона [from, to]
+// в порядке возрастания номеров
+func (s ParcelStore) GetNumberRange(from, to int) ([]Parcel, error) {
+	if from > to {
+		return nil, ErrInvalidRange
+	}
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+" FROM parcel WHERE number BETWEEN :from AND :to ORDER BY number ASC",
+		sql.Named("from", from),
+		sql.Named("to", to))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
+}
+
+// CreatedByHour возвращает количество посылок, созданных в каждый час суток
+// по UTC. Ключ - час от 0 до 23, часы без посылок в карту не попадают
+func (s ParcelStore) CreatedByHour() (map[int]int, error) {
+	rows, err := s.q.Query(`SELECT CAST(strftime('%H', created_at) AS INTEGER) AS hour, COUNT(*)
+FROM parcel
+WHERE strftime('%H', created_at) IS NOT NULL
+GROUP BY hour`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := map[int]int{}
+	for rows.Next() {
+		var hour, count int
+		if err := rows.Scan(&hour, &count); err != nil {
+			return nil, err
+		}
+		hours[hour] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+// NeedsAttention возвращает посылки, нарушающие сроки обработки:
+// зарегистрированные дольше registeredSLA и отправленные дольше sentSLA,
+// но так и не доставленные. Время отсчитывается от последней смены статуса
+func (s ParcelStore) NeedsAttention(registeredSLA, sentSLA time.Duration) ([]Parcel, error) {
+	now := time.Now().UTC()
+
+	rows, err := s.q.Query("SELECT "+parcelColumns+` FROM parcel
+WHERE (status = :registered AND status_changed_at < :registered_before)
+   OR (status = :sent AND status_changed_at < :sent_before)
+ORDER BY status_changed_at ASC, number ASC`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("registered_before", now.Add(-registeredSLA).Format(time.RFC3339)),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("sent_before", now.Add(-sentSLA).Format(time.RFC3339)))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanParcels(rows)
 }
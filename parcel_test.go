@@ -3,6 +3,8 @@ package main
 import (
 	"database/sql"
 	"math/rand"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +20,19 @@ var (
 	randRange = rand.New(randSource)
 )
 
+// setupDB открывает новую БД во временном каталоге теста и создаёт в ней схему
+func setupDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", withBusyTimeout(filepath.Join(t.TempDir(), "tracker.db")))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, Migrate(db))
+
+	return db
+}
+
 // getTestParcel возвращает тестовую посылку
 func getTestParcel() Parcel {
 	return Parcel{
@@ -31,57 +46,77 @@ func getTestParcel() Parcel {
 // TestAddGetDelete проверяет добавление, получение и удаление посылки
 func TestAddGetDelete(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := setupDB(t)
 	store := NewParcelStore(db)
 	parcel := getTestParcel()
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	parcel.Number = id
 
 	// get
-	// получите только что добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что значения всех полей в полученном объекте совпадают со значениями полей в переменной parcel
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, parcel, stored)
 
 	// delete
-	// удалите добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что посылку больше нельзя получить из БД
+	err = store.Delete(id)
+	require.NoError(t, err)
+
+	_, err = store.Get(id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
 }
 
 // TestSetAddress проверяет обновление адреса
 func TestSetAddress(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := setupDB(t)
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
 
 	// set address
-	// обновите адрес, убедитесь в отсутствии ошибки
 	newAddress := "new test address"
+	err = store.SetAddress(id, newAddress)
+	require.NoError(t, err)
 
 	// check
-	// получите добавленную посылку и убедитесь, что адрес обновился
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, newAddress, stored.Address)
 }
 
 // TestSetStatus проверяет обновление статуса
 func TestSetStatus(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := setupDB(t)
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
 
 	// set status
-	// обновите статус, убедитесь в отсутствии ошибки
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
 
 	// check
-	// получите добавленную посылку и убедитесь, что статус обновился
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
 }
 
 // TestGetByClient проверяет получение посылок по идентификатору клиента
 func TestGetByClient(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db := setupDB(t)
+	store := NewParcelStore(db)
 
 	parcels := []Parcel{
 		getTestParcel(),
@@ -98,7 +133,9 @@ func TestGetByClient(t *testing.T) {
 
 	// add
 	for i := 0; i < len(parcels); i++ {
-		id, err := // добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+		id, err := store.Add(parcels[i])
+		require.NoError(t, err)
+		require.NotEmpty(t, id)
 
 		// обновляем идентификатор добавленной у посылки
 		parcels[i].Number = id
@@ -108,14 +145,1607 @@ func TestGetByClient(t *testing.T) {
 	}
 
 	// get by client
-	storedParcels, err := // получите список посылок по идентификатору клиента, сохранённого в переменной client
-	// убедитесь в отсутствии ошибки
-	// убедитесь, что количество полученных посылок совпадает с количеством добавленных
+	storedParcels, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Len(t, storedParcels, len(parcels))
 
 	// check
 	for _, parcel := range storedParcels {
 		// в parcelMap лежат добавленные посылки, ключ - идентификатор посылки, значение - сама посылка
-		// убедитесь, что все посылки из storedParcels есть в parcelMap
-		// убедитесь, что значения полей полученных посылок заполнены верно
+		expected, ok := parcelMap[parcel.Number]
+		require.True(t, ok)
+		require.Equal(t, expected, parcel)
+	}
+}
+
+// TestGetAllChronological проверяет получение посылок в порядке создания
+func TestGetAllChronological(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{2 * time.Hour, 0, time.Hour}
+
+	// add
+	for _, offset := range offsets {
+		parcel := getTestParcel()
+		parcel.CreatedAt = base.Add(offset).Format(time.RFC3339)
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// get all
+	stored, err := store.GetAllChronological(0)
+	require.NoError(t, err)
+	require.Len(t, stored, len(offsets))
+
+	// check
+	for i := 1; i < len(stored); i++ {
+		require.Less(t, stored[i-1].CreatedAt, stored[i].CreatedAt)
+	}
+	require.Equal(t, base.Format(time.RFC3339), stored[0].CreatedAt)
+
+	// get with limit
+	limited, err := store.GetAllChronological(2)
+	require.NoError(t, err)
+	require.Equal(t, stored[:2], limited)
+}
+
+// TestDeleteAllForClient проверяет, что удаление всех посылок клиента
+// не оставляет его данных ни в одной таблице
+func TestDeleteAllForClient(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	statuses := []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered}
+
+	// add
+	var numbers []int
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// архивная и ранее удалённая посылки клиента
+	parcel := getTestParcel()
+	parcel.Client = client
+	archived, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(archived, ParcelStatusDelivered))
+	_, err = db.Exec("UPDATE parcel SET delivered_at = '2024-01-01T00:00:00Z' WHERE number = :number",
+		sql.Named("number", archived))
+	require.NoError(t, err)
+	n, err := store.ArchiveDelivered(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	softDeleted, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(softDeleted))
+	numbers = append(numbers, archived, softDeleted)
+
+	other := getTestParcel()
+	other.Client = client + 1
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+
+	// delete
+	n, err = store.DeleteAllForClient(client)
+	require.NoError(t, err)
+	require.Equal(t, len(statuses)+1, n)
+
+	// check
+	stored, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+
+	for _, table := range []string{"parcel", "parcel_archive", "parcel_deleted"} {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE client = :client",
+			sql.Named("client", client)).Scan(&count)
+		require.NoError(t, err)
+		require.Zero(t, count, table)
+	}
+
+	clause, args := inNumbers(numbers)
+	for _, table := range []string{"parcel_history", "changelog"} {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+clause, args...).Scan(&count)
+		require.NoError(t, err)
+		require.Zero(t, count, table)
+	}
+
+	// данные другого клиента не затронуты
+	_, err = store.Get(otherID)
+	require.NoError(t, err)
+	history, err := store.History(otherID)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+}
+
+// TestFindFutureDated проверяет поиск посылок со временем создания в будущем
+func TestFindFutureDated(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	normal := getTestParcel()
+	normal.CreatedAt = now.Add(-time.Hour).Format(time.RFC3339)
+	_, err := store.Add(normal)
+	require.NoError(t, err)
+
+	// в UTC это 11:30, то есть в прошлом, хотя строка больше now
+	shifted := getTestParcel()
+	shifted.CreatedAt = "2024-03-01T14:30:00+03:00"
+	_, err = store.Add(shifted)
+	require.NoError(t, err)
+
+	future := getTestParcel()
+	future.CreatedAt = now.Add(2 * time.Hour).Format(time.RFC3339)
+	futureID, err := store.Add(future)
+	require.NoError(t, err)
+
+	// check
+	parcels, err := store.FindFutureDated(now)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, futureID, parcels[0].Number)
+}
+
+// TestStuckInSent проверяет поиск посылок, давно находящихся в статусе sent
+func TestStuckInSent(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	// add
+	stuckID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(stuckID, ParcelStatusSent))
+
+	freshID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(freshID, ParcelStatusSent))
+
+	// отправляем первую посылку задним числом
+	longAgo := time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	_, err = db.Exec("UPDATE parcel SET status_changed_at = :changed_at WHERE number = :number",
+		sql.Named("changed_at", longAgo),
+		sql.Named("number", stuckID))
+	require.NoError(t, err)
+
+	// check
+	stuck, err := store.StuckInSent(time.Now().Add(-7 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	require.Equal(t, stuckID, stuck[0].Number)
+}
+
+// TestReadTx проверяет, что чтения внутри ReadTx видят один снимок БД
+func TestReadTx(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	_, err := db.Exec("PRAGMA journal_mode = WAL")
+	require.NoError(t, err)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// read twice with a concurrent update in between
+	err = store.ReadTx(func(tx ParcelStore) error {
+		first, err := tx.Get(id)
+		require.NoError(t, err)
+
+		require.NoError(t, store.SetAddress(id, "new test address"))
+
+		second, err := tx.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, first, second)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "new test address", stored.Address)
+}
+
+// TestSetAddressBulk проверяет массовое обновление адресов
+func TestSetAddressBulk(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	registeredID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	sent := getTestParcel()
+	sent.Status = ParcelStatusSent
+	sentID, err := store.Add(sent)
+	require.NoError(t, err)
+
+	// set addresses
+	n, err := store.SetAddressBulk(map[int]string{
+		registeredID: "new registered address",
+		sentID:       "new sent address",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// check
+	stored, err := store.Get(registeredID)
+	require.NoError(t, err)
+	require.Equal(t, "new registered address", stored.Address)
+
+	stored, err = store.Get(sentID)
+	require.NoError(t, err)
+	require.Equal(t, sent.Address, stored.Address)
+}
+
+// TestSwapAddresses проверяет обмен адресами двух посылок
+func TestSwapAddresses(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	addresses := []string{"Псков, ул. Колотушкина, д. 5", "Москва, ул. Тверская, д. 1"}
+	var numbers []int
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	sent := getTestParcel()
+	sent.Status = ParcelStatusSent
+	sentID, err := store.Add(sent)
+	require.NoError(t, err)
+
+	// swap
+	require.NoError(t, store.SwapAddresses(numbers[0], numbers[1]))
+
+	// check
+	first, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, addresses[1], first.Address)
+
+	second, err := store.Get(numbers[1])
+	require.NoError(t, err)
+	require.Equal(t, addresses[0], second.Address)
+
+	// failures
+	err = store.SwapAddresses(numbers[0], sentID)
+	require.ErrorIs(t, err, ErrNotRegistered)
+
+	err = store.SwapAddresses(numbers[0], sentID+1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	first, err = store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, addresses[1], first.Address)
+
+	stored, err := store.Get(sentID)
+	require.NoError(t, err)
+	require.Equal(t, sent.Address, stored.Address)
+}
+
+// TestOldestUndeliveredPerClient проверяет выбор самой старой недоставленной посылки клиента
+func TestOldestUndeliveredPerClient(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	add := func(client int, status string, offset time.Duration) Parcel {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+		parcel.CreatedAt = base.Add(offset).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		parcel.Number = id
+
+		return parcel
+	}
+
+	// add
+	// у первого клиента самая старая посылка уже доставлена
+	add(1, ParcelStatusDelivered, 0)
+	expected1 := add(1, ParcelStatusSent, time.Hour)
+	add(1, ParcelStatusRegistered, 2*time.Hour)
+
+	expected2 := add(2, ParcelStatusRegistered, 30*time.Minute)
+	add(2, ParcelStatusSent, 3*time.Hour)
+
+	// у третьего клиента все посылки доставлены
+	add(3, ParcelStatusDelivered, 0)
+
+	// check
+	oldest, err := store.OldestUndeliveredPerClient()
+	require.NoError(t, err)
+	require.Equal(t, map[int]Parcel{1: expected1, 2: expected2}, oldest)
+}
+
+// TestGetByMonth проверяет получение посылок за календарный месяц
+func TestGetByMonth(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	createdAt := []string{
+		"2024-01-31T23:59:59Z",
+		"2024-02-01T00:00:00Z",
+		"2024-02-29T23:59:59Z",
+		"2024-03-01T00:00:00Z",
+	}
+
+	// add
+	for _, c := range createdAt {
+		parcel := getTestParcel()
+		parcel.CreatedAt = c
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// get
+	stored, err := store.GetByMonth(2024, time.February)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, stored, 2)
+	require.Equal(t, createdAt[1], stored[0].CreatedAt)
+	require.Equal(t, createdAt[2], stored[1].CreatedAt)
+}
+
+// TestGetStatus проверяет получение статуса посылки
+func TestGetStatus(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	// check
+	status, err := store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	_, err = store.GetStatus(id + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestScanParcel проверяет заполнение всех полей посылки хелперами scanParcel и scanParcels
+func TestScanParcel(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	parcel := getTestParcel()
+	parcel.Status = ParcelStatusSent
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number = id
+
+	// scan one
+	row := db.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE number = :number", sql.Named("number", id))
+	scanned, err := scanParcel(row)
+	require.NoError(t, err)
+	require.Equal(t, parcel, scanned)
+
+	// scan many
+	rows, err := db.Query("SELECT " + parcelColumns + " FROM parcel")
+	require.NoError(t, err)
+	all, err := scanParcels(rows)
+	require.NoError(t, err)
+	require.Equal(t, []Parcel{parcel}, all)
+}
+
+// TestSetPriority проверяет установку и снятие признака срочности
+func TestSetPriority(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.False(t, stored.Priority)
+
+	// set priority
+	require.NoError(t, store.SetPriority(id, true))
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.True(t, stored.Priority)
+
+	// unset priority
+	require.NoError(t, store.SetPriority(id, false))
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.False(t, stored.Priority)
+}
+
+// TestGetProcessingQueue проверяет порядок очереди обработки
+func TestGetProcessingQueue(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	add := func(status string, priority bool, offset time.Duration) int {
+		parcel := getTestParcel()
+		parcel.Status = status
+		parcel.Priority = priority
+		parcel.CreatedAt = base.Add(offset).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+
+		return id
+	}
+
+	// add
+	oldNormal := add(ParcelStatusRegistered, false, 0)
+	newNormal := add(ParcelStatusRegistered, false, 2*time.Hour)
+	newPriority := add(ParcelStatusRegistered, true, 3*time.Hour)
+	oldPriority := add(ParcelStatusRegistered, true, time.Hour)
+	add(ParcelStatusSent, true, 0)
+
+	// check
+	queue, err := store.GetProcessingQueue()
+	require.NoError(t, err)
+
+	var numbers []int
+	for _, parcel := range queue {
+		numbers = append(numbers, parcel.Number)
+	}
+	require.Equal(t, []int{oldPriority, newPriority, oldNormal, newNormal}, numbers)
+}
+
+// TestCountByClient проверяет подсчёт посылок клиента
+func TestCountByClient(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+
+	// empty
+	n, err := store.CountByClient(client)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// add
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Client = client
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	other := getTestParcel()
+	other.Client = client + 1
+	_, err = store.Add(other)
+	require.NoError(t, err)
+
+	// check
+	n, err = store.CountByClient(client)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n, err = store.CountByStatus(ParcelStatusRegistered)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+}
+
+// TestSince проверяет получение посылок с номером больше заданного
+func TestSince(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 4; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// get
+	stored, err := store.Since(numbers[1])
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, stored, 2)
+	require.Equal(t, numbers[2], stored[0].Number)
+	require.Equal(t, numbers[3], stored[1].Number)
+
+	stored, err = store.Since(numbers[3])
+	require.NoError(t, err)
+	require.Empty(t, stored)
+}
+
+// TestFindNumberGaps проверяет поиск пропусков в номерах посылок
+func TestFindNumberGaps(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 6; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// no gaps
+	gaps, err := store.FindNumberGaps()
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+
+	// delete
+	require.NoError(t, store.Delete(numbers[1]))
+	require.NoError(t, store.Delete(numbers[3]))
+	require.NoError(t, store.Delete(numbers[4]))
+
+	// check
+	gaps, err = store.FindNumberGaps()
+	require.NoError(t, err)
+	require.Equal(t, [][2]int{
+		{numbers[1], numbers[1]},
+		{numbers[3], numbers[4]},
+	}, gaps)
+}
+
+// TestDeliveriesPerDay проверяет подсчёт доставок по дням
+func TestDeliveriesPerDay(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	deliveredAt := []string{
+		"2024-03-01T08:00:00Z",
+		"2024-03-01T23:59:59Z",
+		"2024-03-02T10:00:00Z",
+		"2024-03-04T00:00:00Z",
+		// за пределами интервала
+		"2024-02-29T23:59:59Z",
+		"2024-03-05T00:00:00Z",
+	}
+
+	// add
+	for _, d := range deliveredAt {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+
+		_, err = db.Exec("UPDATE parcel SET delivered_at = :delivered_at WHERE number = :number",
+			sql.Named("delivered_at", d),
+			sql.Named("number", id))
+		require.NoError(t, err)
+	}
+
+	// недоставленная посылка не учитывается
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	counts, err := store.DeliveriesPerDay(from, from.AddDate(0, 0, 4))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"2024-03-01": 2,
+		"2024-03-02": 1,
+		"2024-03-04": 1,
+	}, counts)
+}
+
+// TestFindInvalid проверяет поиск посылок с некорректными данными
+func TestFindInvalid(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// add bad rows
+	res, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (1000, 'lost', 'test', '2024-03-01T12:00:00Z')")
+	require.NoError(t, err)
+	badStatus, err := res.LastInsertId()
+	require.NoError(t, err)
+
+	res, err = db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (1000, 'registered', '  ', '2024-03-01T12:00:00Z')")
+	require.NoError(t, err)
+	emptyAddress, err := res.LastInsertId()
+	require.NoError(t, err)
+
+	// check
+	invalid, err := store.FindInvalid()
+	require.NoError(t, err)
+	require.Len(t, invalid, 2)
+	require.Equal(t, int(badStatus), invalid[0].Number)
+	require.Equal(t, int(emptyAddress), invalid[1].Number)
+}
+
+// TestStats проверяет статистику пула соединений
+func TestStats(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	stats := store.Stats()
+	require.GreaterOrEqual(t, stats.OpenConnections, 1)
+	require.Equal(t, stats.OpenConnections, stats.InUse+stats.Idle)
+}
+
+// TestVacuum проверяет сжатие файла БД после массового удаления
+func TestVacuum(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	for i := 0; i < 500; i++ {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Address = strings.Repeat("test address ", 20)
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
 	}
+
+	_, err := store.DeleteAllForClient(client)
+	require.NoError(t, err)
+
+	pageCount := func() int {
+		var n int
+		require.NoError(t, db.QueryRow("PRAGMA page_count").Scan(&n))
+		return n
+	}
+	before := pageCount()
+
+	// внутри транзакции
+	err = store.WithTx(func(tx ParcelStore) error {
+		return tx.Vacuum()
+	})
+	require.ErrorIs(t, err, ErrInTransaction)
+
+	// vacuum
+	require.NoError(t, store.Vacuum())
+
+	// check
+	require.Less(t, pageCount(), before)
+}
+
+// TestQueuePosition проверяет место посылки в очереди клиента
+func TestQueuePosition(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	add := func(status string, offset time.Duration) int {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+		parcel.CreatedAt = base.Add(offset).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+
+		return id
+	}
+
+	// add
+	last := add(ParcelStatusRegistered, 3*time.Hour)
+	middle := add(ParcelStatusRegistered, 2*time.Hour)
+	add(ParcelStatusRegistered, time.Hour)
+	sent := add(ParcelStatusSent, 0)
+
+	// check
+	position, err := store.QueuePosition(middle)
+	require.NoError(t, err)
+	require.Equal(t, 2, position)
+
+	position, err = store.QueuePosition(last)
+	require.NoError(t, err)
+	require.Equal(t, 3, position)
+
+	_, err = store.QueuePosition(sent)
+	require.ErrorIs(t, err, ErrNotRegistered)
+
+	_, err = store.QueuePosition(sent + 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestDistinctAddresses проверяет получение уникальных адресов клиента
+func TestDistinctAddresses(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	addresses := []string{"Псков", "Саратов", "Псков", "Москва", "Саратов"}
+
+	// add
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Address = address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	other := getTestParcel()
+	other.Client = client + 1
+	other.Address = "Тверь"
+	_, err := store.Add(other)
+	require.NoError(t, err)
+
+	// check
+	distinct, err := store.DistinctAddresses(client)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Москва", "Псков", "Саратов"}, distinct)
+}
+
+// TestDispatchAllRegistered проверяет массовую отправку зарегистрированных посылок
+func TestDispatchAllRegistered(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	longAgo := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusDelivered}
+	var numbers []int
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+		parcel.CreatedAt = longAgo.Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// dispatch
+	n, err := store.DispatchAllRegistered()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// check
+	expected := []string{ParcelStatusSent, ParcelStatusSent, ParcelStatusSent, ParcelStatusDelivered}
+	for i, number := range numbers {
+		status, err := store.GetStatus(number)
+		require.NoError(t, err)
+		require.Equal(t, expected[i], status)
+	}
+
+	// у отправленных сейчас посылок обновилось время смены статуса
+	stuck, err := store.StuckInSent(longAgo.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	require.Equal(t, numbers[1], stuck[0].Number)
+}
+
+// TestDispatchAllRegisteredMissingAddress проверяет, что посылки без адреса
+// при массовой отправке остаются зарегистрированными
+func TestDispatchAllRegisteredMissingAddress(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	withAddress, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	parcel := getTestParcel()
+	parcel.Address = " "
+	withoutAddress, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// dispatch
+	n, err := store.DispatchAllRegistered()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// check
+	status, err := store.GetStatus(withAddress)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, status)
+
+	status, err = store.GetStatus(withoutAddress)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, status)
+
+	history, err := store.History(withoutAddress)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+// TestSearchByAddressRegex проверяет поиск посылок по регулярному выражению
+func TestSearchByAddressRegex(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	addresses := []string{"Псков, д. 5", "Саратов, д. 25", "Псков, д. 17"}
+	var numbers []int
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// match
+	found, err := store.SearchByAddressRegex(`^Псков, д\. \d+$`)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[0], found[0].Number)
+	require.Equal(t, numbers[2], found[1].Number)
+
+	// no match
+	found, err = store.SearchByAddressRegex(`Москва`)
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// invalid regex
+	_, err = store.SearchByAddressRegex(`Псков(`)
+	require.Error(t, err)
+}
+
+// TestSetStatusCAS проверяет оптимистичную блокировку при смене статуса
+func TestSetStatusCAS(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// два обработчика читают посылку одной и той же версии
+	first, err := store.Get(id)
+	require.NoError(t, err)
+	second, err := store.Get(id)
+	require.NoError(t, err)
+
+	// first update
+	version, err := store.SetStatusCAS(id, first.Version, ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, first.Version+1, version)
+
+	// stale update
+	_, err = store.SetStatusCAS(id, second.Version, ParcelStatusFailed)
+	require.ErrorIs(t, err, ErrVersionConflict)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
+	require.Equal(t, version, stored.Version)
+
+	// прочие изменения тоже увеличивают версию
+	require.NoError(t, store.SetPriority(id, true))
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, version+1, stored.Version)
+
+	_, err = store.SetStatusCAS(id+1, 0, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestTotal проверяет подсчёт общего количества посылок
+func TestTotal(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	// empty
+	total, err := store.Total()
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	// add
+	for i := 0; i < 3; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// check
+	total, err = store.Total()
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+}
+
+// TestRandomSample проверяет случайную выборку посылок
+func TestRandomSample(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	for i := 0; i < 20; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// sample
+	sample, err := store.RandomSample(5)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, sample, 5)
+	seen := map[int]bool{}
+	for _, parcel := range sample {
+		require.False(t, seen[parcel.Number])
+		seen[parcel.Number] = true
+	}
+
+	// больше, чем есть посылок
+	sample, err = store.RandomSample(50)
+	require.NoError(t, err)
+	require.Len(t, sample, 20)
+
+	// пустая выборка
+	for _, n := range []int{0, -1} {
+		sample, err = store.RandomSample(n)
+		require.NoError(t, err)
+		require.Empty(t, sample, n)
+	}
+}
+
+// TestNeverDispatched проверяет получение ни разу не отправленных посылок
+func TestNeverDispatched(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusDelivered}
+	offsets := []time.Duration{time.Hour, 0, 0, 0}
+	var numbers []int
+	for i, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+		parcel.CreatedAt = base.Add(offsets[i]).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// check
+	parcels, err := store.NeverDispatched()
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, numbers[2], parcels[0].Number)
+	require.Equal(t, numbers[0], parcels[1].Number)
+}
+
+// TestOldestRegistered проверяет выборку самых старых зарегистрированных посылок
+func TestOldestRegistered(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []string{ParcelStatusRegistered, ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusRegistered}
+	offsets := []time.Duration{3 * time.Hour, time.Hour, 0, 2 * time.Hour, time.Hour}
+	var numbers []int
+	for i, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+		parcel.CreatedAt = base.Add(offsets[i]).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// check
+	parcels, err := store.OldestRegistered(3)
+	require.NoError(t, err)
+	require.Len(t, parcels, 3)
+	require.Equal(t, numbers[1], parcels[0].Number)
+	require.Equal(t, numbers[4], parcels[1].Number)
+	require.Equal(t, numbers[3], parcels[2].Number)
+
+	parcels, err = store.OldestRegistered(10)
+	require.NoError(t, err)
+	require.Len(t, parcels, 4)
+
+	parcels, err = store.OldestRegistered(0)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+}
+
+// TestBoard проверяет группировку посылок по статусу
+func TestBoard(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []string{ParcelStatusSent, ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusDelivered}
+	offsets := []time.Duration{2 * time.Hour, 3 * time.Hour, time.Hour, 0, 0}
+	var numbers []int
+	for i, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+		parcel.CreatedAt = base.Add(offsets[i]).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// check
+	board, err := store.Board()
+	require.NoError(t, err)
+
+	bucketNumbers := map[string][]int{}
+	for status, parcels := range board {
+		for _, p := range parcels {
+			require.Equal(t, status, p.Status)
+			bucketNumbers[status] = append(bucketNumbers[status], p.Number)
+		}
+	}
+	require.Equal(t, map[string][]int{
+		ParcelStatusRegistered: {numbers[3], numbers[1]},
+		ParcelStatusSent:       {numbers[2], numbers[0]},
+		ParcelStatusDelivered:  {numbers[4]},
+	}, bucketNumbers)
+}
+
+// TestGetByClientMap проверяет получение посылок клиента в виде map
+func TestGetByClientMap(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	expected := map[int]Parcel{}
+
+	// add
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Client = client
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		parcel.Number = id
+
+		expected[id] = parcel
+	}
+
+	// check
+	stored, err := store.GetByClientMap(client)
+	require.NoError(t, err)
+	require.Equal(t, expected, stored)
+}
+
+// TestDeleteByNumbers проверяет удаление посылок по списку номеров
+func TestDeleteByNumbers(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	statuses := []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusRegistered}
+	var numbers []int
+	for _, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Status = status
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// delete
+	n, err := store.DeleteByNumbers(numbers[:3])
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// check
+	_, err = store.Get(numbers[0])
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.Get(numbers[2])
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = store.Get(numbers[1])
+	require.NoError(t, err)
+	_, err = store.Get(numbers[3])
+	require.NoError(t, err)
+
+	// empty list
+	n, err = store.DeleteByNumbers(nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+// TestSetDimensions проверяет сохранение веса и габаритов посылки
+func TestSetDimensions(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set dimensions
+	require.NoError(t, store.SetDimensions(id, 1500, 300, 200, 100))
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, 1500, stored.WeightGrams)
+	require.Equal(t, 300, stored.LengthMM)
+	require.Equal(t, 200, stored.WidthMM)
+	require.Equal(t, 100, stored.HeightMM)
+
+	// negative values
+	err = store.SetDimensions(id, 1500, -1, 200, 100)
+	require.ErrorIs(t, err, ErrInvalidDimensions)
+
+	stored, err = store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, 300, stored.LengthMM)
+}
+
+// TestGetNumberRange проверяет получение посылок из диапазона номеров
+func TestGetNumberRange(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 6; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+	require.NoError(t, store.Delete(numbers[2]))
+
+	// get
+	stored, err := store.GetNumberRange(numbers[1], numbers[4])
+	require.NoError(t, err)
+
+	// check
+	var got []int
+	for _, parcel := range stored {
+		got = append(got, parcel.Number)
+	}
+	require.Equal(t, []int{numbers[1], numbers[3], numbers[4]}, got)
+
+	_, err = store.GetNumberRange(numbers[4], numbers[1])
+	require.ErrorIs(t, err, ErrInvalidRange)
+}
+
+// TestCreatedByHour проверяет распределение созданных посылок по часам
+func TestCreatedByHour(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	createdAt := []string{
+		"2024-03-01T00:15:00Z",
+		"2024-03-02T09:00:00Z",
+		"2024-03-03T09:59:59Z",
+		"2024-03-04T23:30:00Z",
+		// время с часовым поясом приводится к UTC
+		"2024-03-05T12:10:00+03:00",
+	}
+	for _, c := range createdAt {
+		parcel := getTestParcel()
+		parcel.CreatedAt = c
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// get
+	hours, err := store.CreatedByHour()
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, map[int]int{0: 1, 9: 3, 23: 1}, hours)
+}
+
+// TestNeedsAttention проверяет выборку посылок, нарушающих сроки обработки
+func TestNeedsAttention(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	add := func(status string, changedAgo time.Duration) int {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		if status != ParcelStatusRegistered {
+			require.NoError(t, store.SetStatus(id, status))
+		}
+
+		changedAt := time.Now().Add(-changedAgo).UTC().Format(time.RFC3339)
+		_, err = db.Exec("UPDATE parcel SET status_changed_at = :changed_at WHERE number = :number",
+			sql.Named("changed_at", changedAt),
+			sql.Named("number", id))
+		require.NoError(t, err)
+
+		return id
+	}
+
+	lateRegistered := add(ParcelStatusRegistered, 3*24*time.Hour)
+	add(ParcelStatusRegistered, time.Hour)
+	lateSent := add(ParcelStatusSent, 10*24*time.Hour)
+	add(ParcelStatusSent, 2*24*time.Hour)
+	add(ParcelStatusDelivered, 30*24*time.Hour)
+
+	// check
+	parcels, err := store.NeedsAttention(24*time.Hour, 7*24*time.Hour)
+	require.NoError(t, err)
+
+	var got []int
+	for _, parcel := range parcels {
+		got = append(got, parcel.Number)
+	}
+	require.ElementsMatch(t, []int{lateRegistered, lateSent}, got)
+}
+
+// TestHasUndelivered проверяет наличие недоставленных посылок у клиента
+func TestHasUndelivered(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	deliveredClient := getTestParcel()
+	deliveredClient.Client = 101
+	for i := 0; i < 2; i++ {
+		id, err := store.Add(deliveredClient)
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+	}
+
+	sentClient := getTestParcel()
+	sentClient.Client = 102
+	deliveredID, err := store.Add(sentClient)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(deliveredID, ParcelStatusDelivered))
+	sentID, err := store.Add(sentClient)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sentID, ParcelStatusSent))
+
+	// check
+	has, err := store.HasUndelivered(deliveredClient.Client)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	has, err = store.HasUndelivered(sentClient.Client)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	has, err = store.HasUndelivered(103)
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+// TestAllDelivered проверяет признак полной доставки посылок клиента
+func TestAllDelivered(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	deliveredClient := getTestParcel()
+	deliveredClient.Client = 101
+	for i := 0; i < 2; i++ {
+		id, err := store.Add(deliveredClient)
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+	}
+
+	mixedClient := getTestParcel()
+	mixedClient.Client = 102
+	deliveredID, err := store.Add(mixedClient)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(deliveredID, ParcelStatusDelivered))
+	_, err = store.Add(mixedClient)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		client   int
+		expected bool
+	}{
+		{name: "all delivered", client: deliveredClient.Client, expected: true},
+		{name: "mixed", client: mixedClient.Client, expected: false},
+		{name: "no parcels", client: 103, expected: false},
+	}
+
+	// check
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivered, err := store.AllDelivered(tt.client)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, delivered)
+		})
+	}
+}
+
+// TestShiftCreatedAt проверяет сдвиг времени создания посылок
+func TestShiftCreatedAt(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.CreatedAt = base.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// shift
+	n, err := store.ShiftCreatedAt([]int{numbers[0], numbers[2], numbers[2] + 100}, -3*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// check
+	expected := []string{"2024-03-01T09:00:00Z", "2024-03-01T13:00:00Z", "2024-03-01T11:00:00Z"}
+	for i, number := range numbers {
+		stored, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, expected[i], stored.CreatedAt)
+
+		history, err := store.History(number)
+		require.NoError(t, err)
+		require.Equal(t, expected[i], history[0].ChangedAt)
+	}
+
+	n, err = store.ShiftCreatedAt(nil, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+// TestShiftCreatedAtStatusTimes проверяет, что вместе со временем создания
+// сдвигаются время смены статуса и доставки, а из истории - только запись
+// о создании
+func TestShiftCreatedAtStatusTimes(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	parcel := getTestParcel()
+	parcel.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	parcel.Status = ParcelStatusDelivered
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// запись истории в ту же секунду, что и создание
+	_, err = db.Exec("INSERT INTO parcel_history (number, status, changed_at) VALUES (:number, :status, :changed_at)",
+		sql.Named("number", id),
+		sql.Named("status", ParcelStatusFailed),
+		sql.Named("changed_at", parcel.CreatedAt))
+	require.NoError(t, err)
+
+	// shift
+	n, err := store.ShiftCreatedAt([]int{id}, 3*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// check
+	created, err := time.Parse(time.RFC3339, parcel.CreatedAt)
+	require.NoError(t, err)
+	shifted := created.Add(3 * time.Hour).Format(time.RFC3339)
+
+	var statusChangedAt, deliveredAt string
+	require.NoError(t, db.QueryRow("SELECT status_changed_at, delivered_at FROM parcel WHERE number = :number",
+		sql.Named("number", id)).Scan(&statusChangedAt, &deliveredAt))
+	require.Equal(t, shifted, statusChangedAt)
+	require.Equal(t, shifted, deliveredAt)
+
+	history, err := store.History(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	changedAt := map[string]string{}
+	for _, h := range history {
+		changedAt[h.Status] = h.ChangedAt
+	}
+	require.Equal(t, shifted, changedAt[ParcelStatusDelivered])
+	require.Equal(t, parcel.CreatedAt, changedAt[ParcelStatusFailed])
+
+	issues, err := store.Audit()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+}
+
+// TestGetStatuses проверяет получение статусов нескольких посылок одним запросом
+func TestGetStatuses(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	registeredID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	sentID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sentID, ParcelStatusSent))
+
+	// get
+	statuses, err := store.GetStatuses([]int{registeredID, sentID + 100, sentID, registeredID + 200})
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, map[int]string{
+		registeredID: ParcelStatusRegistered,
+		sentID:       ParcelStatusSent,
+	}, statuses)
+
+	statuses, err = store.GetStatuses(nil)
+	require.NoError(t, err)
+	require.Empty(t, statuses)
+}
+
+// TestGetByClientWithPositions проверяет места в очереди, вычисленные одним запросом
+func TestGetByClientWithPositions(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	client := randRange.Intn(10_000_000)
+	statuses := []string{
+		ParcelStatusRegistered,
+		ParcelStatusSent,
+		ParcelStatusRegistered,
+		ParcelStatusDelivered,
+		ParcelStatusRegistered,
+	}
+	for i, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Client = client
+		parcel.Status = status
+		parcel.CreatedAt = time.Date(2024, time.March, 1+i, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// посылка другого клиента не влияет на очередь
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// get
+	parcels, err := store.GetByClientWithPositions(client)
+	require.NoError(t, err)
+	require.Len(t, parcels, len(statuses))
+
+	// check
+	var positions []int
+	last := 0
+	for _, p := range parcels {
+		require.Equal(t, client, p.Client)
+		if p.Status != ParcelStatusRegistered {
+			require.Zero(t, p.Position)
+			continue
+		}
+
+		require.Greater(t, p.Position, last)
+		last = p.Position
+		positions = append(positions, p.Position)
+
+		position, err := store.QueuePosition(p.Number)
+		require.NoError(t, err)
+		require.Equal(t, position, p.Position)
+	}
+	require.Equal(t, []int{1, 2, 3}, positions)
+}
+
+// TestTruncate проверяет полную очистку таблицы и сброс нумерации
+func TestTruncate(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	}
+
+	// truncate
+	require.NoError(t, store.Truncate())
+
+	// check
+	total, err := store.Total()
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	history, err := store.History(first)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, first, id)
+}
+
+// TestGetByCity проверяет выборку посылок по городу в адресе
+func TestGetByCity(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	addresses := map[string]bool{
+		"Псков, ул. Колотушкина, д. 5": true,
+		"Псков": true,
+		"Россия, Псков, Октябрьский пр., 1": true,
+		"Россия, Псков":                     true,
+		"Псковская обл., Остров":            false,
+		"Москва, ул. Псковская, д. 2":       false,
+		"Москва, Тверская 1":                false,
+		"Пск_в, ул. Ленина, 1":              false,
+	}
+	want := map[int]bool{}
+	for address, match := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		if match {
+			want[id] = true
+		}
+	}
+
+	// get
+	parcels, err := store.GetByCity(" Псков ")
+	require.NoError(t, err)
+
+	// check
+	got := map[int]bool{}
+	for _, p := range parcels {
+		got[p.Number] = true
+	}
+	require.Equal(t, want, got)
+
+	// спецсимволы LIKE сравниваются буквально
+	parcels, err = store.GetByCity("Пск_в")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, "Пск_в, ул. Ленина, 1", parcels[0].Address)
+
+	parcels, err = store.GetByCity("%")
+	require.NoError(t, err)
+	require.Empty(t, parcels)
 }
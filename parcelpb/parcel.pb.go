@@ -0,0 +1,273 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: parcel.proto
+
+package parcelpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Parcel посылка в том виде, в котором она передаётся в gRPC-сервисы
+type Parcel struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Number  int64  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Client  int64  `protobuf:"varint,2,opt,name=client,proto3" json:"client,omitempty"`
+	Status  string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Address string `protobuf:"bytes,4,opt,name=address,proto3" json:"address,omitempty"`
+	// created_at время создания в формате RFC 3339
+	CreatedAt   string `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Priority    bool   `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"`
+	Attempts    int64  `protobuf:"varint,7,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Version     int64  `protobuf:"varint,8,opt,name=version,proto3" json:"version,omitempty"`
+	WeightGrams int64  `protobuf:"varint,9,opt,name=weight_grams,json=weightGrams,proto3" json:"weight_grams,omitempty"`
+	LengthMm    int64  `protobuf:"varint,10,opt,name=length_mm,json=lengthMm,proto3" json:"length_mm,omitempty"`
+	WidthMm     int64  `protobuf:"varint,11,opt,name=width_mm,json=widthMm,proto3" json:"width_mm,omitempty"`
+	HeightMm    int64  `protobuf:"varint,12,opt,name=height_mm,json=heightMm,proto3" json:"height_mm,omitempty"`
+	ClaimedBy   string `protobuf:"bytes,13,opt,name=claimed_by,json=claimedBy,proto3" json:"claimed_by,omitempty"`
+	ClaimedAt   string `protobuf:"bytes,14,opt,name=claimed_at,json=claimedAt,proto3" json:"claimed_at,omitempty"`
+}
+
+func (x *Parcel) Reset() {
+	*x = Parcel{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_parcel_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Parcel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Parcel) ProtoMessage() {}
+
+func (x *Parcel) ProtoReflect() protoreflect.Message {
+	mi := &file_parcel_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Parcel.ProtoReflect.Descriptor instead.
+func (*Parcel) Descriptor() ([]byte, []int) {
+	return file_parcel_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Parcel) GetNumber() int64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Parcel) GetClient() int64 {
+	if x != nil {
+		return x.Client
+	}
+	return 0
+}
+
+func (x *Parcel) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Parcel) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Parcel) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *Parcel) GetPriority() bool {
+	if x != nil {
+		return x.Priority
+	}
+	return false
+}
+
+func (x *Parcel) GetAttempts() int64 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *Parcel) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Parcel) GetWeightGrams() int64 {
+	if x != nil {
+		return x.WeightGrams
+	}
+	return 0
+}
+
+func (x *Parcel) GetLengthMm() int64 {
+	if x != nil {
+		return x.LengthMm
+	}
+	return 0
+}
+
+func (x *Parcel) GetWidthMm() int64 {
+	if x != nil {
+		return x.WidthMm
+	}
+	return 0
+}
+
+func (x *Parcel) GetHeightMm() int64 {
+	if x != nil {
+		return x.HeightMm
+	}
+	return 0
+}
+
+func (x *Parcel) GetClaimedBy() string {
+	if x != nil {
+		return x.ClaimedBy
+	}
+	return ""
+}
+
+func (x *Parcel) GetClaimedAt() string {
+	if x != nil {
+		return x.ClaimedAt
+	}
+	return ""
+}
+
+var File_parcel_proto protoreflect.FileDescriptor
+
+var file_parcel_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x70, 0x61, 0x72, 0x63, 0x65, 0x6c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07,
+	0x74, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x22, 0x91, 0x03, 0x0a, 0x06, 0x50, 0x61, 0x72, 0x63,
+	0x65, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x06, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f,
+	0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65,
+	0x64, 0x41, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12,
+	0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70, 0x74, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x5f,
+	0x67, 0x72, 0x61, 0x6d, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x77, 0x65, 0x69,
+	0x67, 0x68, 0x74, 0x47, 0x72, 0x61, 0x6d, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x65, 0x6e, 0x67,
+	0x74, 0x68, 0x5f, 0x6d, 0x6d, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x6c, 0x65, 0x6e,
+	0x67, 0x74, 0x68, 0x4d, 0x6d, 0x12, 0x19, 0x0a, 0x08, 0x77, 0x69, 0x64, 0x74, 0x68, 0x5f, 0x6d,
+	0x6d, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x77, 0x69, 0x64, 0x74, 0x68, 0x4d, 0x6d,
+	0x12, 0x1b, 0x0a, 0x09, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x5f, 0x6d, 0x6d, 0x18, 0x0c, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x08, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x4d, 0x6d, 0x12, 0x1d, 0x0a,
+	0x0a, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x42, 0x79, 0x12, 0x1d, 0x0a, 0x0a,
+	0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x41, 0x74, 0x42, 0x36, 0x5a, 0x34, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x59, 0x61, 0x6e, 0x64, 0x65, 0x78,
+	0x2d, 0x50, 0x72, 0x61, 0x63, 0x74, 0x69, 0x63, 0x75, 0x6d, 0x2f, 0x67, 0x6f, 0x2d, 0x64, 0x62,
+	0x2d, 0x73, 0x71, 0x6c, 0x2d, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x61, 0x72, 0x63, 0x65,
+	0x6c, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_parcel_proto_rawDescOnce sync.Once
+	file_parcel_proto_rawDescData = file_parcel_proto_rawDesc
+)
+
+func file_parcel_proto_rawDescGZIP() []byte {
+	file_parcel_proto_rawDescOnce.Do(func() {
+		file_parcel_proto_rawDescData = protoimpl.X.CompressGZIP(file_parcel_proto_rawDescData)
+	})
+	return file_parcel_proto_rawDescData
+}
+
+var file_parcel_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_parcel_proto_goTypes = []any{
+	(*Parcel)(nil), // 0: tracker.Parcel
+}
+var file_parcel_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_parcel_proto_init() }
+func file_parcel_proto_init() {
+	if File_parcel_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_parcel_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*Parcel); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_parcel_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_parcel_proto_goTypes,
+		DependencyIndexes: file_parcel_proto_depIdxs,
+		MessageInfos:      file_parcel_proto_msgTypes,
+	}.Build()
+	File_parcel_proto = out.File
+	file_parcel_proto_rawDesc = nil
+	file_parcel_proto_goTypes = nil
+	file_parcel_proto_depIdxs = nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// PricingRule одно правило расчёта стоимости доставки. Apply получает
+// посылку и цену в копейках после предыдущих правил и возвращает новую:
+// базовая цена, скидка или надбавка в зависимости от статуса и приоритета
+type PricingRule interface {
+	Apply(p Parcel, price int) int
+}
+
+// Price рассчитывает стоимость доставки посылки в копейках, применяя
+// правила rules по порядку к нулевой начальной цене
+func (s ParcelService) Price(number int, rules []PricingRule) (int, error) {
+	parcel, err := s.store.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParcelNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	price := 0
+	for _, rule := range rules {
+		price = rule.Apply(parcel, price)
+	}
+
+	return price, nil
+}
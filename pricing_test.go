@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// basePrice задаёт цену, не зависящую от посылки
+type basePrice int
+
+func (b basePrice) Apply(_ Parcel, price int) int {
+	return price + int(b)
+}
+
+// prioritySurcharge увеличивает цену приоритетной посылки на percent процентов
+type prioritySurcharge int
+
+func (s prioritySurcharge) Apply(p Parcel, price int) int {
+	if !p.Priority {
+		return price
+	}
+	return price + price*int(s)/100
+}
+
+// TestPrice проверяет расчёт стоимости доставки по правилам
+func TestPrice(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	regular, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	p := getTestParcel()
+	p.Priority = true
+	priority, err := store.Add(p)
+	require.NoError(t, err)
+
+	rules := []PricingRule{basePrice(30000), prioritySurcharge(50)}
+
+	// check
+	price, err := service.Price(regular, rules)
+	require.NoError(t, err)
+	require.Equal(t, 30000, price)
+
+	price, err = service.Price(priority, rules)
+	require.NoError(t, err)
+	require.Equal(t, 45000, price)
+
+	price, err = service.Price(priority, nil)
+	require.NoError(t, err)
+	require.Zero(t, price)
+
+	_, err = service.Price(priority+1, rules)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/Yandex-Practicum/go-db-sql-final/parcelpb"
+	"google.golang.org/protobuf/proto"
+)
+
+//go:generate protoc -I parcelpb --go_out=parcelpb --go_opt=paths=source_relative parcel.proto
+
+// ToProto переводит посылку в сообщение parcelpb.Parcel для gRPC-сервисов
+func (p Parcel) ToProto() *parcelpb.Parcel {
+	return &parcelpb.Parcel{
+		Number:      int64(p.Number),
+		Client:      int64(p.Client),
+		Status:      p.Status,
+		Address:     p.Address,
+		CreatedAt:   p.CreatedAt,
+		Priority:    p.Priority,
+		Attempts:    int64(p.Attempts),
+		Version:     int64(p.Version),
+		WeightGrams: int64(p.WeightGrams),
+		LengthMm:    int64(p.LengthMM),
+		WidthMm:     int64(p.WidthMM),
+		HeightMm:    int64(p.HeightMM),
+		ClaimedBy:   p.ClaimedBy,
+		ClaimedAt:   p.ClaimedAt,
+	}
+}
+
+// FromProto переводит сообщение parcelpb.Parcel обратно в посылку
+func FromProto(m *parcelpb.Parcel) Parcel {
+	return Parcel{
+		Number:      int(m.GetNumber()),
+		Client:      int(m.GetClient()),
+		Status:      m.GetStatus(),
+		Address:     m.GetAddress(),
+		CreatedAt:   m.GetCreatedAt(),
+		Priority:    m.GetPriority(),
+		Attempts:    int(m.GetAttempts()),
+		Version:     int(m.GetVersion()),
+		WeightGrams: int(m.GetWeightGrams()),
+		LengthMM:    int(m.GetLengthMm()),
+		WidthMM:     int(m.GetWidthMm()),
+		HeightMM:    int(m.GetHeightMm()),
+		ClaimedBy:   m.GetClaimedBy(),
+		ClaimedAt:   m.GetClaimedAt(),
+	}
+}
+
+// MarshalParcelProto сериализует посылку в двоичный формат protobuf
+func MarshalParcelProto(p Parcel) ([]byte, error) {
+	return proto.Marshal(p.ToProto())
+}
+
+// UnmarshalParcelProto разбирает посылку, сериализованную MarshalParcelProto
+func UnmarshalParcelProto(data []byte) (Parcel, error) {
+	var m parcelpb.Parcel
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return Parcel{}, err
+	}
+
+	return FromProto(&m), nil
+}
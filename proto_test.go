@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestParcelProtoRoundTrip проверяет, что все поля посылки
+// переживают сериализацию в protobuf
+func TestParcelProtoRoundTrip(t *testing.T) {
+	parcel := Parcel{
+		Number:      42,
+		Client:      1000,
+		Status:      ParcelStatusProcessing,
+		Address:     "Псков, ул. Колотушкина, д. 5",
+		CreatedAt:   "2024-03-01T12:30:00Z",
+		Priority:    true,
+		Attempts:    2,
+		Version:     7,
+		WeightGrams: 1500,
+		LengthMM:    300,
+		WidthMM:     200,
+		HeightMM:    100,
+		ClaimedBy:   "worker-1",
+		ClaimedAt:   "2024-03-02T08:00:00Z",
+	}
+
+	require.Equal(t, parcel, FromProto(parcel.ToProto()))
+
+	data, err := MarshalParcelProto(parcel)
+	require.NoError(t, err)
+
+	decoded, err := UnmarshalParcelProto(data)
+	require.NoError(t, err)
+	require.Equal(t, parcel, decoded)
+
+	// пустая посылка тоже переживает сериализацию
+	data, err = MarshalParcelProto(Parcel{})
+	require.NoError(t, err)
+	decoded, err = UnmarshalParcelProto(data)
+	require.NoError(t, err)
+	require.Equal(t, Parcel{}, decoded)
+
+	_, err = UnmarshalParcelProto([]byte{0xff, 0xff})
+	require.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const receiptRule = "--------------------------------"
+
+// ErrInvalidQRPayload возвращается, когда строку из QR-кода квитанции
+// не удаётся разобрать
+var ErrInvalidQRPayload = errors.New("некорректные данные QR-кода")
+
+// Receipt возвращает текст квитанции для печати на стойке выдачи
+func (p Parcel) Receipt() string {
+	created := p.CreatedAt
+	if t, err := time.Parse(time.RFC3339, p.CreatedAt); err == nil {
+		created = t.Format("02.01.2006")
+	}
+
+	var b strings.Builder
+	b.WriteString("КВИТАНЦИЯ\n")
+	b.WriteString(receiptRule + "\n")
+	fmt.Fprintf(&b, "%-10s %d\n", "Посылка:", p.Number)
+	fmt.Fprintf(&b, "%-10s %d\n", "Клиент:", p.Client)
+	fmt.Fprintf(&b, "%-10s %s\n", "Адрес:", p.Address)
+	fmt.Fprintf(&b, "%-10s %s\n", "Статус:", p.Status)
+	fmt.Fprintf(&b, "%-10s %s\n", "Создана:", created)
+	b.WriteString(receiptRule + "\n")
+
+	return b.String()
+}
+
+// QRPayload возвращает компактную строку для QR-кода квитанции
+// вида P:<номер>|C:<клиент>|S:<статус>
+func (p Parcel) QRPayload() string {
+	return fmt.Sprintf("P:%d|C:%d|S:%s", p.Number, p.Client, p.Status)
+}
+
+// ParseQRPayload разбирает строку, полученную из QRPayload
+func ParseQRPayload(s string) (number, client int, status string, err error) {
+	parts := strings.Split(s, "|")
+	if len(parts) != 3 {
+		return 0, 0, "", ErrInvalidQRPayload
+	}
+
+	values := make([]string, len(parts))
+	for i, prefix := range []string{"P:", "C:", "S:"} {
+		v, ok := strings.CutPrefix(parts[i], prefix)
+		if !ok || v == "" {
+			return 0, 0, "", ErrInvalidQRPayload
+		}
+		values[i] = v
+	}
+
+	number, err = strconv.Atoi(values[0])
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %w", ErrInvalidQRPayload, err)
+	}
+	client, err = strconv.Atoi(values[1])
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %w", ErrInvalidQRPayload, err)
+	}
+	status, err = ParseStatus(values[2])
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %w", ErrInvalidQRPayload, err)
+	}
+
+	return number, client, status, nil
+}
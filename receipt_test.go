@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReceipt сравнивает квитанцию с эталоном из testdata
+func TestReceipt(t *testing.T) {
+	parcel := Parcel{
+		Number:    42,
+		Client:    1000,
+		Status:    ParcelStatusRegistered,
+		Address:   "Псков, ул. Колотушкина, д. 5",
+		CreatedAt: "2024-03-01T12:30:00Z",
+	}
+
+	expected, err := os.ReadFile(filepath.Join("testdata", "receipt.golden"))
+	require.NoError(t, err)
+
+	require.Equal(t, string(expected), parcel.Receipt())
+}
+
+// TestQRPayloadRoundTrip проверяет, что данные QR-кода разбираются обратно
+func TestQRPayloadRoundTrip(t *testing.T) {
+	parcels := []Parcel{
+		{Number: 42, Client: 1000, Status: ParcelStatusRegistered},
+		{Number: 1, Client: 7, Status: ParcelStatusDelivered},
+		{Number: 123456, Client: 99, Status: ParcelStatusProcessing},
+	}
+
+	for _, p := range parcels {
+		payload := p.QRPayload()
+
+		number, client, status, err := ParseQRPayload(payload)
+		require.NoError(t, err, payload)
+		require.Equal(t, p.Number, number)
+		require.Equal(t, p.Client, client)
+		require.Equal(t, p.Status, status)
+	}
+
+	require.Equal(t, "P:42|C:1000|S:registered", parcels[0].QRPayload())
+}
+
+// TestParseQRPayloadMalformed проверяет отказ разбирать некорректные строки
+func TestParseQRPayloadMalformed(t *testing.T) {
+	payloads := []string{
+		"",
+		"P:42|C:1000",
+		"P:42|C:1000|S:sent|X:1",
+		"C:1000|P:42|S:sent",
+		"P:|C:1000|S:sent",
+		"P:abc|C:1000|S:sent",
+		"P:42|C:1x|S:sent",
+		"P:42|C:1000|S:lost",
+	}
+
+	for _, payload := range payloads {
+		_, _, _, err := ParseQRPayload(payload)
+		require.ErrorIs(t, err, ErrInvalidQRPayload, payload)
+	}
+}
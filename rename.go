@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"slices"
+)
+
+var (
+	// ErrInvalidStatusName возвращается для недопустимого имени статуса
+	ErrInvalidStatusName = errors.New("недопустимое имя статуса")
+	// ErrStatusNameTaken возвращается, когда новое имя статуса уже занято
+	ErrStatusNameTaken = errors.New("имя статуса уже используется")
+)
+
+// statusTables таблицы, в которых хранится статус посылки
+var statusTables = []string{"parcel", "parcel_history", "parcel_archive", "parcel_deleted"}
+
+// statusNamePattern допустимое имя статуса: строчные латинские буквы,
+// цифры и подчёркивания, начиная с буквы
+var statusNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RenameStatus в одной транзакции переименовывает статус oldName в newName
+// у всех посылок, в истории статусов, архиве и корзине и возвращает
+// количество изменённых посылок. newName должен состоять из строчных
+// латинских букв, цифр и подчёркиваний, иначе возвращается
+// ErrInvalidStatusName. Если newName - один из статусов посылки или уже
+// встречается в данных, возвращается ErrStatusNameTaken: иначе статусы
+// незаметно слились бы в один
+func (s ParcelStore) RenameStatus(oldName, newName string) (int, error) {
+	if !statusNamePattern.MatchString(newName) || newName == oldName {
+		return 0, ErrInvalidStatusName
+	}
+	if slices.Contains(parcelStatuses, newName) {
+		return 0, ErrStatusNameTaken
+	}
+
+	var renamed int
+	err := s.inTx(nil, func(tx ParcelStore) error {
+		for _, table := range statusTables {
+			var taken bool
+			err := tx.q.QueryRow("SELECT EXISTS (SELECT 1 FROM "+table+" WHERE status = :new)",
+				sql.Named("new", newName)).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrStatusNameTaken
+			}
+		}
+
+		if err := tx.addChangesWhere(ChangeSetStatus, "status = :old", sql.Named("old", oldName)); err != nil {
+			return err
+		}
+
+		res, err := tx.q.Exec("UPDATE parcel SET status = :new, version = version + 1 WHERE status = :old",
+			sql.Named("new", newName),
+			sql.Named("old", oldName))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		renamed = int(n)
+
+		for _, table := range statusTables[1:] {
+			_, err := tx.q.Exec("UPDATE "+table+" SET status = :new WHERE status = :old",
+				sql.Named("new", newName),
+				sql.Named("old", oldName))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return renamed, nil
+}
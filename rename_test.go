@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenameStatus проверяет переименование статуса у посылок и в истории
+func TestRenameStatus(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	var sent []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		sent = append(sent, id)
+	}
+	registeredID, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// rename
+	n, err := store.RenameStatus(ParcelStatusSent, "in_transit")
+	require.NoError(t, err)
+	require.Equal(t, len(sent), n)
+
+	// check
+	for _, id := range sent {
+		status, err := store.GetStatus(id)
+		require.NoError(t, err)
+		require.Equal(t, "in_transit", status)
+
+		history, err := store.History(id)
+		require.NoError(t, err)
+		require.Equal(t, "in_transit", history[len(history)-1].Status)
+	}
+
+	status, err := store.GetStatus(registeredID)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, status)
+
+	count, err := store.CountByStatus(ParcelStatusSent)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	// invalid names
+	for _, name := range []string{"", "In Transit", "1sent", "in-transit", "in_transit"} {
+		_, err = store.RenameStatus("in_transit", name)
+		require.ErrorIs(t, err, ErrInvalidStatusName, name)
+	}
+}
+
+// TestRenameStatusTaken проверяет, что статус нельзя переименовать
+// в уже используемое имя
+func TestRenameStatusTaken(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	_, err = store.RenameStatus(ParcelStatusSent, "in_transit")
+	require.NoError(t, err)
+
+	// check
+	for _, name := range []string{ParcelStatusDelivered, ParcelStatusRegistered} {
+		_, err = store.RenameStatus("in_transit", name)
+		require.ErrorIs(t, err, ErrStatusNameTaken, name)
+	}
+
+	// после переименования прежнее имя освобождается
+	_, err = store.RenameStatus("in_transit", "handed_over")
+	require.NoError(t, err)
+	_, err = store.RenameStatus("handed_over", "in_transit")
+	require.NoError(t, err)
+
+	// имя занято посылкой с другим статусом
+	id, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.RenameStatus(ParcelStatusRegistered, "handed_over")
+	require.NoError(t, err)
+	_, err = store.RenameStatus("handed_over", "in_transit")
+	require.ErrorIs(t, err, ErrStatusNameTaken)
+
+	status, err := store.GetStatus(id)
+	require.NoError(t, err)
+	require.Equal(t, "handed_over", status)
+}
+
+// TestRenameStatusArchiveAndDeleted проверяет переименование статуса
+// у посылок в архиве и в корзине
+func TestRenameStatusArchiveAndDeleted(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+
+	archived, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(archived, ParcelStatusDelivered))
+	n, err := store.ArchiveDelivered(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	deleted, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(deleted))
+
+	// rename
+	_, err = store.RenameStatus(ParcelStatusDelivered, "handed_over")
+	require.NoError(t, err)
+	_, err = store.RenameStatus(ParcelStatusRegistered, "accepted")
+	require.NoError(t, err)
+
+	// check
+	var status string
+	require.NoError(t, db.QueryRow("SELECT status FROM parcel_archive WHERE number = ?", archived).Scan(&status))
+	require.Equal(t, "handed_over", status)
+	require.NoError(t, db.QueryRow("SELECT status FROM parcel_deleted WHERE number = ?", deleted).Scan(&status))
+	require.Equal(t, "accepted", status)
+}
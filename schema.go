@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// schemaV1 первый шаг миграции: создаёт таблицы parcel, parcel_history,
+// parcel_archive, parcel_deleted и индексы, если их ещё нет, и добавляет
+// в существующую таблицу parcel недостающие столбцы. Так выглядела схема
+// до появления версий. Шаг уже применён к рабочим БД, поэтому не меняется:
+// новые таблицы и столбцы добавляются только новыми шагами в migrations
+func schemaV1(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS parcel (
+    number INTEGER PRIMARY KEY AUTOINCREMENT,
+    client INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    address VARCHAR(256) NOT NULL,
+    created_at VARCHAR(256) NOT NULL,
+    status_changed_at VARCHAR(256) NOT NULL DEFAULT '',
+    priority BOOLEAN NOT NULL DEFAULT 0,
+    delivered_at VARCHAR(256) NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 0,
+    weight_grams INTEGER NOT NULL DEFAULT 0,
+    length_mm INTEGER NOT NULL DEFAULT 0,
+    width_mm INTEGER NOT NULL DEFAULT 0,
+    height_mm INTEGER NOT NULL DEFAULT 0,
+    claimed_by VARCHAR(256) NOT NULL DEFAULT '',
+    claimed_at VARCHAR(256) NOT NULL DEFAULT '',
+    metadata TEXT
+);
+CREATE INDEX IF NOT EXISTS parcel_client ON parcel (client);
+CREATE INDEX IF NOT EXISTS parcel_status ON parcel (status);
+CREATE TABLE IF NOT EXISTS parcel_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    changed_at VARCHAR(256) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS parcel_history_number ON parcel_history (number);
+CREATE TABLE IF NOT EXISTS parcel_archive (
+    number INTEGER PRIMARY KEY,
+    client INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    address VARCHAR(256) NOT NULL,
+    created_at VARCHAR(256) NOT NULL,
+    status_changed_at VARCHAR(256) NOT NULL DEFAULT '',
+    priority BOOLEAN NOT NULL DEFAULT 0,
+    delivered_at VARCHAR(256) NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 0,
+    weight_grams INTEGER NOT NULL DEFAULT 0,
+    length_mm INTEGER NOT NULL DEFAULT 0,
+    width_mm INTEGER NOT NULL DEFAULT 0,
+    height_mm INTEGER NOT NULL DEFAULT 0,
+    claimed_by VARCHAR(256) NOT NULL DEFAULT '',
+    claimed_at VARCHAR(256) NOT NULL DEFAULT '',
+    metadata TEXT,
+    archived_at VARCHAR(256) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS parcel_deleted (
+    number INTEGER PRIMARY KEY,
+    client INTEGER NOT NULL,
+    status VARCHAR(128) NOT NULL,
+    address VARCHAR(256) NOT NULL,
+    created_at VARCHAR(256) NOT NULL,
+    deleted_at VARCHAR(256) NOT NULL
+);
+`)
+	if err != nil {
+		return err
+	}
+
+	// столбцы, появившиеся после первой версии таблицы
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"status_changed_at", "VARCHAR(256) NOT NULL DEFAULT ''"},
+		{"priority", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"delivered_at", "VARCHAR(256) NOT NULL DEFAULT ''"},
+		{"attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"version", "INTEGER NOT NULL DEFAULT 0"},
+		{"weight_grams", "INTEGER NOT NULL DEFAULT 0"},
+		{"length_mm", "INTEGER NOT NULL DEFAULT 0"},
+		{"width_mm", "INTEGER NOT NULL DEFAULT 0"},
+		{"height_mm", "INTEGER NOT NULL DEFAULT 0"},
+		{"claimed_by", "VARCHAR(256) NOT NULL DEFAULT ''"},
+		{"claimed_at", "VARCHAR(256) NOT NULL DEFAULT ''"},
+		{"metadata", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, "parcel", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backfillStatusChangedAt заполняет время смены статуса у посылок,
+// созданных до появления столбца status_changed_at. Точное время уже
+// не узнать, поэтому берётся время создания посылки: иначе пустая строка
+// меньше любой даты, и StuckInSent находил бы все такие посылки
+func backfillStatusChangedAt(tx *sql.Tx) error {
+	_, err := tx.Exec("UPDATE parcel SET status_changed_at = created_at WHERE status_changed_at = ''")
+
+	return err
+}
+
+// createChangelog создаёт таблицу журнала изменений changelog
+func createChangelog(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS changelog (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number INTEGER NOT NULL,
+    op VARCHAR(32) NOT NULL,
+    changed_at VARCHAR(256) NOT NULL
+)`)
+
+	return err
+}
+
+// addColumnIfMissing добавляет столбец column в таблицу table,
+// если его там ещё нет
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(:table)", sql.Named("table", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+
+	return err
+}
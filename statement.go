@@ -0,0 +1,44 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+)
+
+// clientStatementTemplate выписка по посылкам клиента в виде HTML-таблицы.
+// html/template экранирует все значения, в том числе адреса
+var clientStatementTemplate = template.Must(template.New("statement").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Посылки клиента {{.Client}}</title></head>
+<body>
+<h1>Посылки клиента {{.Client}}</h1>
+<table>
+<thead>
+<tr><th>Номер</th><th>Адрес</th><th>Статус</th><th>Зарегистрирована</th></tr>
+</thead>
+<tbody>
+{{- range .Parcels}}
+<tr><td>{{.Number}}</td><td>{{.Address}}</td><td>{{.Status}}</td><td>{{.CreatedAt}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// RenderClientHTML записывает в w выписку по посылкам клиента в виде
+// HTML-таблицы, упорядоченной по номерам посылок, для отправки
+// клиенту по почте или печати в PDF
+func (s ParcelService) RenderClientHTML(client int, w io.Writer) error {
+	parcels, err := s.store.GetByClient(client)
+	if err != nil {
+		return err
+	}
+	sort.Slice(parcels, func(i, j int) bool { return parcels[i].Number < parcels[j].Number })
+
+	return clientStatementTemplate.Execute(w, struct {
+		Client  int
+		Parcels []Parcel
+	}{client, parcels})
+}
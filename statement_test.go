@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderClientHTML проверяет HTML-выписку по посылкам клиента
+func TestRenderClientHTML(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	service := NewParcelService(store)
+
+	client := 1000
+	_, err := service.Register(client, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+	_, err = service.Register(client, `<script>alert("x")</script> & Co`)
+	require.NoError(t, err)
+	_, err = service.Register(client+1, "Москва, ул. Тверская, д. 1")
+	require.NoError(t, err)
+
+	// render
+	var buf bytes.Buffer
+	require.NoError(t, service.RenderClientHTML(client, &buf))
+	out := buf.String()
+
+	// check
+	require.Contains(t, out, "Псков, ул. Колотушкина, д. 5")
+	require.Contains(t, out, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; Co")
+	require.NotContains(t, out, "<script>")
+	require.NotContains(t, out, "Москва")
+
+	// строка заголовка и по строке на посылку
+	require.Equal(t, 3, strings.Count(out, "<tr>"))
+}
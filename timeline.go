@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+// события TimelineEntry
+const (
+	TimelineCreated       = "created"
+	TimelineStatusChanged = "status_changed"
+)
+
+// TimelineEntry событие в хронологии посылки
+type TimelineEntry struct {
+	At time.Time `json:"at"`
+	// Event один из TimelineCreated, TimelineStatusChanged
+	Event string `json:"event"`
+	// Status статус посылки после события
+	Status string `json:"status"`
+}
+
+// Timeline возвращает хронологию посылки: создание и все смены статуса,
+// упорядоченные по времени
+func (s ParcelService) Timeline(number int) ([]TimelineEntry, error) {
+	var parcel Parcel
+	var history []HistoryEntry
+	err := s.store.ReadTx(func(tx ParcelStore) error {
+		var err error
+		parcel, err = tx.Get(number)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrParcelNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		history, err = tx.History(number)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, parcel.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add записывает начальный статус в историю со временем создания,
+	// эта запись и есть событие создания
+	initialStatus := parcel.Status
+	if len(history) > 0 && history[0].ChangedAt == parcel.CreatedAt {
+		initialStatus = history[0].Status
+		history = history[1:]
+	}
+
+	timeline := []TimelineEntry{{At: createdAt, Event: TimelineCreated, Status: initialStatus}}
+	for _, h := range history {
+		at, err := time.Parse(time.RFC3339, h.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		timeline = append(timeline, TimelineEntry{At: at, Event: TimelineStatusChanged, Status: h.Status})
+	}
+
+	// создание остаётся первым, даже если время в истории совпадает с ним
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].At.Before(timeline[j].At)
+	})
+
+	return timeline, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTimeline проверяет хронологию посылки: сначала создание,
+// затем смены статуса по порядку
+func TestTimeline(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db)
+	createdAt := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	service := NewParcelService(store, WithLogger(&recordingLogger{}), WithClock(fixedClock{now: createdAt}))
+
+	parcel, err := service.Register(1000, "Псков, ул. Колотушкина, д. 5")
+	require.NoError(t, err)
+
+	// advance
+	require.NoError(t, service.NextStatus(parcel.Number))
+	require.NoError(t, service.NextStatus(parcel.Number))
+
+	// check
+	timeline, err := service.Timeline(parcel.Number)
+	require.NoError(t, err)
+	require.Len(t, timeline, 3)
+
+	require.Equal(t, TimelineEntry{At: createdAt, Event: TimelineCreated, Status: ParcelStatusRegistered}, timeline[0])
+	require.Equal(t, TimelineStatusChanged, timeline[1].Event)
+	require.Equal(t, ParcelStatusSent, timeline[1].Status)
+	require.Equal(t, TimelineStatusChanged, timeline[2].Event)
+	require.Equal(t, ParcelStatusDelivered, timeline[2].Status)
+	require.False(t, timeline[2].At.Before(timeline[1].At))
+	require.True(t, timeline[1].At.After(createdAt))
+
+	_, err = service.Timeline(parcel.Number + 100)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// contextQuerier часть *sql.DB и *sql.Tx с методами, принимающими контекст
+type contextQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// timeoutQuerier выполняет каждый запрос с контекстом, производным от parent
+// и ограниченным timeout. Истёкший таймаут возвращается как
+// context.DeadlineExceeded, timeout <= 0 - без ограничения
+type timeoutQuerier struct {
+	q       contextQuerier
+	parent  context.Context
+	timeout time.Duration
+}
+
+// context возвращает контекст для одного запроса и функцию, освобождающую его
+func (q timeoutQuerier) context() (context.Context, context.CancelFunc) {
+	if q.timeout <= 0 {
+		return q.parent, func() {}
+	}
+
+	return context.WithTimeout(q.parent, q.timeout)
+}
+
+func (q timeoutQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := q.context()
+	defer cancel()
+
+	return q.q.ExecContext(ctx, query, args...)
+}
+
+// Query ограничивает таймаутом и сам запрос, и чтение строк результата.
+// Строки читаются уже после возврата из Query, поэтому контекст
+// освобождается, когда строки закончились или закрыты
+func (q timeoutQuerier) Query(query string, args ...interface{}) (sqlRows, error) {
+	ctx, cancel := q.context()
+
+	rows, err := q.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return cancelRows{Rows: rows, cancel: cancel}, nil
+}
+
+// QueryRow, как и Query, ограничивает таймаутом и чтение строки:
+// контекст освобождается после Scan
+func (q timeoutQuerier) QueryRow(query string, args ...interface{}) sqlRow {
+	ctx, cancel := q.context()
+
+	return cancelRow{Row: q.q.QueryRowContext(ctx, query, args...), cancel: cancel}
+}
+
+// cancelRows строки результата, освобождающие контекст запроса,
+// как только они прочитаны до конца или закрыты
+type cancelRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (r cancelRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+
+	return false
+}
+
+func (r cancelRows) Close() error {
+	defer r.cancel()
+
+	return r.Rows.Close()
+}
+
+// cancelRow строка результата, освобождающая контекст запроса после Scan
+type cancelRow struct {
+	*sql.Row
+	cancel context.CancelFunc
+}
+
+func (r cancelRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+
+	return r.Row.Scan(dest...)
+}
+
+// WithQueryTimeout возвращает копию хранилища, в которой каждая операция
+// прерывается с context.DeadlineExceeded, если не уложилась в timeout.
+// Операции в транзакции (WithTx, ReadTx) ограничиваются целиком.
+// timeout <= 0 снимает ограничение. Внутри транзакции хранилище
+// возвращается без изменений: для неё уже действует таймаут,
+// заданный при её начале
+func (s ParcelStore) WithQueryTimeout(timeout time.Duration) ParcelStore {
+	if s.tx != nil {
+		return s
+	}
+
+	s.timeout = timeout
+	s.q = s.counts.wrap(timeoutQuerier{q: s.db, parent: context.Background(), timeout: timeout})
+
+	return s
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowQuerier имитирует зависший запрос: Exec и Query ждут отмены контекста
+type slowQuerier struct {
+	*sql.DB
+}
+
+func (slowQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestQueryTimeout проверяет, что долгий запрос прерывается по таймауту
+func TestQueryTimeout(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db).WithQueryTimeout(50 * time.Millisecond)
+
+	// быстрые операции укладываются в таймаут
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Get(id)
+	require.NoError(t, err)
+
+	// медленные запросы прерываются
+	store.q = timeoutQuerier{q: slowQuerier{DB: db}, parent: context.Background(), timeout: store.timeout}
+
+	start := time.Now()
+	err = store.SetPriority(id, true)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = store.GetByClient(getTestParcel().Client)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	// без таймаута хранилище работает как раньше
+	store = store.WithQueryTimeout(0)
+	require.NoError(t, store.SetPriority(id, true))
+}
+
+// ctxRecorder запоминает контексты запросов на чтение
+type ctxRecorder struct {
+	*sql.DB
+	ctxs *[]context.Context
+}
+
+func (r ctxRecorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	*r.ctxs = append(*r.ctxs, ctx)
+	return r.DB.QueryContext(ctx, query, args...)
+}
+
+func (r ctxRecorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	*r.ctxs = append(*r.ctxs, ctx)
+	return r.DB.QueryRowContext(ctx, query, args...)
+}
+
+// TestQueryTimeoutReleased проверяет, что контекст запроса освобождается
+// сразу после чтения результата, а не по истечении таймаута
+func TestQueryTimeoutReleased(t *testing.T) {
+	// prepare
+	db := setupDB(t)
+	store := NewParcelStore(db).WithQueryTimeout(time.Hour)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	var ctxs []context.Context
+	store.q = timeoutQuerier{q: ctxRecorder{DB: db, ctxs: &ctxs}, parent: context.Background(), timeout: store.timeout}
+
+	// read
+	_, err = store.Get(id)
+	require.NoError(t, err)
+	_, err = store.GetByClient(getTestParcel().Client)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, ctxs, 2)
+	for _, ctx := range ctxs {
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// VolumetricWeightGrams возвращает объёмный вес посылки в граммах:
+// произведение габаритов в миллиметрах, делённое на divisor.
+// Для привычного делителя перевозчиков 5000 (см³/кг) значение
+// в миллиметрах сразу даёт граммы. При divisor <= 0 возвращается 0
+func (p Parcel) VolumetricWeightGrams(divisor int) int {
+	if divisor <= 0 {
+		return 0
+	}
+
+	return p.LengthMM * p.WidthMM * p.HeightMM / divisor
+}
+
+// BillableWeightGrams возвращает вес для расчёта стоимости доставки:
+// большее из фактического и объёмного веса
+func (p Parcel) BillableWeightGrams(divisor int) int {
+	volumetric := p.VolumetricWeightGrams(divisor)
+	if volumetric > p.WeightGrams {
+		return volumetric
+	}
+
+	return p.WeightGrams
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestBillableWeightGrams проверяет расчёт объёмного и оплачиваемого веса
+func TestBillableWeightGrams(t *testing.T) {
+	tests := []struct {
+		name       string
+		parcel     Parcel
+		divisor    int
+		volumetric int
+		billable   int
+	}{
+		{
+			name:       "heavy and small",
+			parcel:     Parcel{WeightGrams: 5000, LengthMM: 100, WidthMM: 100, HeightMM: 100},
+			divisor:    5000,
+			volumetric: 200,
+			billable:   5000,
+		},
+		{
+			name:       "light and bulky",
+			parcel:     Parcel{WeightGrams: 1000, LengthMM: 600, WidthMM: 400, HeightMM: 400},
+			divisor:    5000,
+			volumetric: 19200,
+			billable:   19200,
+		},
+		{
+			name:       "other divisor",
+			parcel:     Parcel{WeightGrams: 1000, LengthMM: 600, WidthMM: 400, HeightMM: 400},
+			divisor:    6000,
+			volumetric: 16000,
+			billable:   16000,
+		},
+		{
+			name:       "not measured",
+			parcel:     Parcel{WeightGrams: 700},
+			divisor:    5000,
+			volumetric: 0,
+			billable:   700,
+		},
+		{
+			name:       "invalid divisor",
+			parcel:     Parcel{WeightGrams: 700, LengthMM: 600, WidthMM: 400, HeightMM: 400},
+			divisor:    0,
+			volumetric: 0,
+			billable:   700,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.volumetric, tt.parcel.VolumetricWeightGrams(tt.divisor))
+			require.Equal(t, tt.billable, tt.parcel.BillableWeightGrams(tt.divisor))
+		})
+	}
+}